@@ -1,10 +1,13 @@
 package backends
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -22,17 +25,29 @@ type File struct {
 
 // WriteTo will pass a writer to the provided function
 func (fb *File) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return fb.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will pass a writer to the provided function, the partially written
+// file is removed if the context is done before the function returns
+func (fb *File) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	// Ensure our context hasn't been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	// We decided to make dir here every call to WriteTo to ensure the service is durable.
 	// In the off-chance there is someone manually deleting directories, or another service
 	// manipulating the same directories. We want to ensure the service continues to work
 	// as intended
-	if err = os.MkdirAll(fb.dir, 0744); err != nil {
-		return
-	}
-
 	// Filename is a mixture of the File directory and the provided key
 	filename := path.Join(fb.dir, key)
 
+	// Keys may contain slashes, so we make the parent directory of the file rather than the root directory
+	if err = os.MkdirAll(path.Dir(filename), 0744); err != nil {
+		return
+	}
+
 	var f *os.File
 	// Create a file at the given filename
 	if f, err = os.Create(filename); err != nil {
@@ -40,9 +55,14 @@ func (fb *File) WriteTo(key string, fn func(io.Writer) error) (err error) {
 	}
 
 	// We want to return this error because this was the first in the chain
-	err = fn(f)
+	err = fn(newContextWriter(ctx, f))
 	f.Close()
 
+	if err == nil {
+		// Ensure our context wasn't cancelled after the last write
+		err = ctx.Err()
+	}
+
 	if err != nil {
 		// We encountered an error, delete the file
 		os.Remove(filename)
@@ -53,6 +73,16 @@ func (fb *File) WriteTo(key string, fn func(io.Writer) error) (err error) {
 
 // ReadFrom will pass a reader to the provided function
 func (fb *File) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return fb.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will pass a reader to the provided function, reads will fail once the context is done
+func (fb *File) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	// Ensure our context hasn't been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	var f *os.File
 	// Filename is a mixture of the File directory and the provided key
 	filename := path.Join(fb.dir, key)
@@ -63,55 +93,125 @@ func (fb *File) ReadFrom(key string, fn func(io.Reader) error) (err error) {
 	// Defer the closing of the file
 	defer f.Close()
 	// Call provided func and pass file
-	return fn(f)
+	return fn(newContextReader(ctx, f))
 }
 
 // Delete will delete a key
 func (fb *File) Delete(key string) (err error) {
+	return fb.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will delete a key
+func (fb *File) DeleteContext(ctx context.Context, key string) (err error) {
+	// Ensure our context hasn't been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	return os.Remove(filepath.Join(fb.dir, key))
 }
 
+// Size will return the size of a key in bytes
+func (fb *File) Size(key string) (size int64, err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(filepath.Join(fb.dir, key)); err != nil {
+		return
+	}
+
+	size = info.Size()
+	return
+}
+
 // ForEach will iterate through all the keys
 func (fb *File) ForEach(prefix, marker string, maxKeys int64, fn ForEachFn) (err error) {
+	return fb.ForEachContext(context.Background(), prefix, marker, maxKeys, fn)
+}
+
+// ForEachContext will iterate through all the keys until the context is done
+// Note: Keys are relative to the File directory, use forward slashes and are iterated in sorted order.
+// The prefix must match the beginning of a key (older versions matched the prefix anywhere within the
+// file name, ignoring directories)
+func (fb *File) ForEachContext(ctx context.Context, prefix, marker string, maxKeys int64, fn ForEachFn) (err error) {
 	var cnt int64
-	err = filepath.Walk(fb.dir, func(filepath string, info os.FileInfo, ierr error) (err error) {
-		if info == nil {
-			return
+	// Only the directory holding the prefix can contain matching keys, start the walk there
+	var dir string
+	if i := strings.LastIndex(prefix, "/"); i > -1 {
+		dir = prefix[:i]
+	}
+
+	err = fb.walk(ctx, dir, prefix, marker, func(key string) (err error) {
+		if maxKeys != -1 && cnt == maxKeys {
+			return Break
 		}
 
+		cnt++
+		return fn(key)
+	})
+
+	if err == Break {
+		err = nil
+	}
+
+	return
+}
+
+// walk will call the provided function for each key within the provided directory which matches
+// the provided prefix and follows the provided marker, in key order
+// Note: Directories which cannot contain a matching key are skipped. Entries are visited in key order
+// by sorting directories as their key prefix (name + "/"), as '.' sorts before '/'
+func (fb *File) walk(ctx context.Context, dir, prefix, marker string, fn ForEachFn) (err error) {
+	// Ensure our context hasn't been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(filepath.Join(fb.dir, filepath.FromSlash(dir))); os.IsNotExist(err) {
+		// Directory has not been created yet, there are no keys
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	entries := make([]string, 0, len(infos))
+	for _, info := range infos {
+		entry := path.Join(dir, info.Name())
 		if info.IsDir() {
-			return
+			entry += "/"
 		}
 
-		// Truncate filepath to exclude the directory
-		filepath = path.Base(filepath)
+		entries = append(entries, entry)
+	}
 
-		if strings.Index(filepath, prefix) == -1 {
-			return
-		}
+	sort.Strings(entries)
 
-		// Check to see if we've past the marker yet
-		if filepath <= marker {
-			return
-		}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry, "/") {
+			// Check to see if the key matches our prefix and we've past the marker yet
+			if !strings.HasPrefix(entry, prefix) || entry <= marker {
+				continue
+			}
 
-		if err = fn(filepath); err != nil {
-			return
-		}
+			if err = fn(entry); err != nil {
+				return
+			}
 
-		if maxKeys == -1 {
-			return
+			continue
 		}
 
-		if cnt++; cnt == maxKeys {
-			return Break
+		if !strings.HasPrefix(entry, prefix) && !strings.HasPrefix(prefix, entry) {
+			// Directory cannot contain a key which matches our prefix
+			continue
 		}
 
-		return
-	})
+		if entry < marker && !strings.HasPrefix(marker, entry) {
+			// Every key within the directory sorts before our marker
+			continue
+		}
 
-	if err == Break {
-		err = nil
+		if err = fb.walk(ctx, strings.TrimSuffix(entry, "/"), prefix, marker, fn); err != nil {
+			return
+		}
 	}
 
 	return
@@ -119,12 +219,17 @@ func (fb *File) ForEach(prefix, marker string, maxKeys int64, fn ForEachFn) (err
 
 // Next will return the next key
 func (fb *File) Next(prefix, marker string) (nextKey string, err error) {
-	err = fb.ForEach(prefix, marker, 1, func(key string) (err error) {
+	return fb.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key
+func (fb *File) NextContext(ctx context.Context, prefix, marker string) (nextKey string, err error) {
+	err = fb.ForEachContext(ctx, prefix, marker, 1, func(key string) (err error) {
 		nextKey = key
 		return
 	})
 
-	if len(nextKey) == 0 {
+	if err == nil && len(nextKey) == 0 {
 		err = io.EOF
 	}
 
@@ -133,7 +238,12 @@ func (fb *File) Next(prefix, marker string) (nextKey string, err error) {
 
 // List will list the available keys
 func (fb *File) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
-	err = fb.ForEach(prefix, marker, maxKeys, func(key string) (err error) {
+	return fb.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the available keys
+func (fb *File) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	err = fb.ForEachContext(ctx, prefix, marker, maxKeys, func(key string) (err error) {
 		keys = append(keys, key)
 		return
 	})
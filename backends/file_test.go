@@ -73,3 +73,48 @@ func TestFile(t *testing.T) {
 		t.Fatalf("io.EOF expected, received: %v", err)
 	}
 }
+
+func TestFile_Nested(t *testing.T) {
+	var (
+		fb  *File
+		err error
+	)
+
+	defer os.RemoveAll("test_data")
+	fb = NewFile("test_data")
+
+	// Write keys out of order, including a file which sorts between a directory and it's contents
+	for _, key := range []string{"b/2026/b.2.txt", "a/2026/a.1.txt", "a.latest.txt", "a/2026/a.2.txt", "a/2027/a.3.txt", "ab/2026/ab.1.txt"} {
+		if err = fb.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world\n"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		prefix   string
+		marker   string
+		maxKeys  int64
+		expected []string
+	}{
+		{prefix: "", marker: "", maxKeys: -1, expected: []string{"a.latest.txt", "a/2026/a.1.txt", "a/2026/a.2.txt", "a/2027/a.3.txt", "ab/2026/ab.1.txt", "b/2026/b.2.txt"}},
+		{prefix: "a/", marker: "", maxKeys: -1, expected: []string{"a/2026/a.1.txt", "a/2026/a.2.txt", "a/2027/a.3.txt"}},
+		{prefix: "a/", marker: "a/2026/a.1.txt", maxKeys: 1, expected: []string{"a/2026/a.2.txt"}},
+		{prefix: "a/2027/", marker: "", maxKeys: -1, expected: []string{"a/2027/a.3.txt"}},
+		{prefix: "a", marker: "a/2027", maxKeys: 2, expected: []string{"a/2027/a.3.txt", "ab/2026/ab.1.txt"}},
+		{prefix: "c/", marker: "", maxKeys: -1, expected: nil},
+	}
+
+	for _, tc := range tcs {
+		var keys []string
+		if keys, err = fb.List(tc.prefix, tc.marker, tc.maxKeys); err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(keys) != fmt.Sprint(tc.expected) {
+			t.Fatalf("invalid keys for prefix \"%s\" and marker \"%s\", expected %v and received %v", tc.prefix, tc.marker, tc.expected, keys)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"os"
@@ -84,13 +85,13 @@ func (s *S3) newIterator(prefix, marker string, maxKeys int64) (output *s3.ListO
 	return s.s.ListObjects(input)
 }
 
-func (s *S3) upload(key string, r io.Reader, opts S3UploadOpts) (location string, err error) {
+func (s *S3) upload(ctx context.Context, key string, r io.Reader, opts S3UploadOpts) (location string, err error) {
 	// Create new upload input
 	input := s.newUploadInput(key, r, opts)
 
 	var out *s3manager.UploadOutput
 	// Upload writer to amazon
-	if out, err = s.u.Upload(&input); err != nil {
+	if out, err = s.u.UploadWithContext(ctx, &input); err != nil {
 		return
 	}
 
@@ -98,24 +99,36 @@ func (s *S3) upload(key string, r io.Reader, opts S3UploadOpts) (location string
 	return
 }
 
-func (s *S3) delete(key string) (err error) {
+func (s *S3) delete(ctx context.Context, key string) (err error) {
 	// Create new delete input
 	input := s.newDeleteInput(key)
 	// Delete key from amazon
-	_, err = s.s.DeleteObject(&input)
+	_, err = s.s.DeleteObjectWithContext(ctx, &input)
 	return
 }
 
 // WriteTo will write to a writer
 func (s *S3) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return s.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will write to a writer, the upload is aborted if the context is done
+func (s *S3) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	// Ensure our context hasn't been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	var tmp *os.File
 	if tmp, err = ioutil.TempFile("", "s3_backend"); err != nil {
 		return
 	}
 	defer os.Remove(tmp.Name())
+	// Defer the close of the temporary file
+	defer tmp.Close()
 
 	// Write to temporary file
-	if err = fn(tmp); err != nil {
+	if err = fn(newContextWriter(ctx, tmp)); err != nil {
 		return
 	}
 
@@ -130,18 +143,23 @@ func (s *S3) WriteTo(key string, fn func(io.Writer) error) (err error) {
 	}
 
 	// Upload file to amazon
-	_, err = s.upload(key, tmp, defaultS3UploadOpts)
+	_, err = s.upload(ctx, key, tmp, defaultS3UploadOpts)
 	return
 }
 
 // Upload will upload a reader to s3
 func (s *S3) Upload(key string, r io.Reader, opts S3UploadOpts) (location string, err error) {
 	// Upload file to amazon
-	return s.upload(key, r, opts)
+	return s.upload(context.Background(), key, r, opts)
 }
 
 // ReadFrom will pass a reader to the provided function
 func (s *S3) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return s.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will pass a reader to the provided function, the download is aborted if the context is done
+func (s *S3) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
 	var tmp *os.File
 	// Create temporary file to write to
 	if tmp, err = ioutil.TempFile("", "s3_backend"); err != nil {
@@ -155,7 +173,7 @@ func (s *S3) ReadFrom(key string, fn func(io.Reader) error) (err error) {
 	// Create new object input
 	objInput := s.newObjectInput(key)
 	// Download the object input request to the temporary file
-	if _, err = s.d.Download(tmp, &objInput); err != nil {
+	if _, err = s.d.DownloadWithContext(ctx, tmp, &objInput); err != nil {
 		// Error encountered while downloading, return
 		return
 	}
@@ -164,12 +182,32 @@ func (s *S3) ReadFrom(key string, fn func(io.Reader) error) (err error) {
 		return
 	}
 	// Call function and pass temporary file as reader
-	return fn(tmp)
+	return fn(newContextReader(ctx, tmp))
 }
 
 // Delete will delete a file from the s3 backend
 func (s *S3) Delete(key string) (err error) {
-	return s.delete(key)
+	return s.delete(context.Background(), key)
+}
+
+// DeleteContext will delete a file from the s3 backend
+func (s *S3) DeleteContext(ctx context.Context, key string) (err error) {
+	return s.delete(ctx, key)
+}
+
+// Size will return the size of a key in bytes
+func (s *S3) Size(key string) (size int64, err error) {
+	var input s3.HeadObjectInput
+	input.Bucket = aws.String(s.bucket)
+	input.Key = aws.String(key)
+
+	var out *s3.HeadObjectOutput
+	if out, err = s.s.HeadObject(&input); err != nil {
+		return
+	}
+
+	size = aws.Int64Value(out.ContentLength)
+	return
 }
 
 // ForEach will iterate through all the keys
@@ -199,15 +237,25 @@ func (s *S3) ForEach(prefix, marker string, maxKeys int64, fn ForEachFn) (err er
 
 // Next will return the next key
 func (s *S3) Next(prefix, marker string) (nextKey string, err error) {
+	return s.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key
+func (s *S3) NextContext(ctx context.Context, prefix, marker string) (nextKey string, err error) {
 	// Create new iterator
-	iter := newIterator(s.s, s.bucket, prefix, marker, 1)
+	iter := newIteratorWithContext(ctx, s.s, s.bucket, prefix, marker, 1)
 	// Get next key
 	return iter.Next()
 }
 
 // List will list the backend keys
 func (s *S3) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
-	iter := newIterator(s.s, s.bucket, prefix, marker, maxKeys)
+	return s.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the backend keys
+func (s *S3) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	iter := newIteratorWithContext(ctx, s.s, s.bucket, prefix, marker, maxKeys)
 
 	// Iterate until error
 	for {
@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"io"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -15,7 +16,13 @@ const (
 
 // newIterator will return a new iterator
 func newIterator(s3 *s3.S3, bucket, prefix, marker string, maxKeys int64) *S3Iterator {
+	return newIteratorWithContext(context.Background(), s3, bucket, prefix, marker, maxKeys)
+}
+
+// newIteratorWithContext will return a new iterator whose list requests are bound to the provided context
+func newIteratorWithContext(ctx context.Context, s3 *s3.S3, bucket, prefix, marker string, maxKeys int64) *S3Iterator {
 	var s3i S3Iterator
+	s3i.ctx = ctx
 	s3i.s3 = s3
 	s3i.bucket = bucket
 	s3i.prefix = prefix
@@ -26,7 +33,8 @@ func newIterator(s3 *s3.S3, bucket, prefix, marker string, maxKeys int64) *S3Ite
 
 // S3Iterator iterates through an s3 bucket
 type S3Iterator struct {
-	s3 *s3.S3
+	ctx context.Context
+	s3  *s3.S3
 
 	bucket string
 	prefix string
@@ -104,7 +112,7 @@ func (i *S3Iterator) setOutput() (err error) {
 	input := i.newInput()
 
 	// Set output as a new Objects list
-	i.output, err = i.s3.ListObjects(input)
+	i.output, err = i.s3.ListObjectsWithContext(i.ctx, input)
 	return
 }
 
@@ -1,4 +1,75 @@
 package backends
 
+import (
+	"context"
+	"io"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrNotSeekable is returned when seeking a reader which does not support seeking
+	ErrNotSeekable = errors.Error("underlying reader does not support seeking")
+)
+
 // ForEachFn is called for ForEach methods
 type ForEachFn func(key string) (err error)
+
+// newContextWriter will return a new writer which fails once the provided context is done
+func newContextWriter(ctx context.Context, w io.Writer) *contextWriter {
+	var c contextWriter
+	c.ctx = ctx
+	c.w = w
+	return &c
+}
+
+// contextWriter is a writer which fails once it's context is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write will write to the underlying writer as long as the context is not done
+func (c *contextWriter) Write(bs []byte) (n int, err error) {
+	// Ensure our context hasn't been cancelled
+	if err = c.ctx.Err(); err != nil {
+		return
+	}
+
+	return c.w.Write(bs)
+}
+
+// newContextReader will return a new reader which fails once the provided context is done
+func newContextReader(ctx context.Context, r io.Reader) *contextReader {
+	var c contextReader
+	c.ctx = ctx
+	c.r = r
+	return &c
+}
+
+// contextReader is a reader which fails once it's context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read will read from the underlying reader as long as the context is not done
+func (c *contextReader) Read(bs []byte) (n int, err error) {
+	// Ensure our context hasn't been cancelled
+	if err = c.ctx.Err(); err != nil {
+		return
+	}
+
+	return c.r.Read(bs)
+}
+
+// Seek will seek the underlying reader (if it supports seeking)
+func (c *contextReader) Seek(offset int64, whence int) (n int64, err error) {
+	seeker, ok := c.r.(io.Seeker)
+	if !ok {
+		err = ErrNotSeekable
+		return
+	}
+
+	return seeker.Seek(offset, whence)
+}
@@ -0,0 +1,54 @@
+package snapshotter
+
+import (
+	"context"
+	"time"
+)
+
+// lastRun will return the time of the last successful snapshot
+// Note: The completion time recorded within the latest snapshot's manifest is preferred, snapshots
+// made by older versions fall back to the (truncated) time encoded within the latest key
+func (s *Snapshotter) lastRun(ctx context.Context) (t time.Time, err error) {
+	var key string
+	if key, err = s.getLatest(ctx); err != nil {
+		return
+	}
+
+	if m, merr := s.getManifest(ctx, key); merr == nil && !m.End.IsZero() {
+		return m.End, nil
+	}
+
+	_, _, t, err = s.codec.Decode(key)
+	return
+}
+
+// isOverdue will determine if a scheduled snapshot was missed since the last successful snapshot
+func (s *Snapshotter) isOverdue(ctx context.Context, now time.Time) (overdue bool) {
+	last, err := s.lastRun(ctx)
+	if err != nil {
+		// No previous snapshot could be found, we are overdue
+		return true
+	}
+
+	// Schedules are evaluated within our configured location
+	next := s.schedule.Next(last.In(s.cfg.getLocation()))
+	return !next.IsZero() && !next.After(now)
+}
+
+// newStartupTimer will return the timer for the first snapshot. When catch-up is enabled and a scheduled
+// snapshot was missed (e.g. while the service was down), the timer fires once the startup delay has elapsed
+func (s *Snapshotter) newStartupTimer() (timer *time.Timer) {
+	if !s.cfg.CatchUp {
+		return s.newScheduleTimer()
+	}
+
+	now := time.Now()
+	if !s.isOverdue(s.work, now) {
+		return s.newScheduleTimer()
+	}
+
+	next := now.Add(s.cfg.StartupDelay)
+	s.cfg.Logger.Info("snapshot is overdue, catching up", Fields{"name": s.cfg.Name, "at": next.Format(time.RFC3339)})
+	s.nextRun.Store(next.UnixNano())
+	return time.NewTimer(s.cfg.StartupDelay)
+}
@@ -0,0 +1,67 @@
+package snapshotter
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestSnapshotter_CatchUp(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only catch-up snapshots will run
+	cfg.Interval = Hour
+	cfg.CatchUp = true
+	cfg.StartupDelay = time.Millisecond * 100
+
+	start := func() (fe *testFrontend, s *Snapshotter) {
+		var err error
+		fe = &testFrontend{}
+		if s, err = New(fe, be, cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	// No previous snapshot exists, we should catch up after the startup delay
+	fe, s := start()
+	if next := time.Until(s.NextRun()); next > cfg.StartupDelay {
+		t.Fatalf("invalid next run, expected within %v and received %v", cfg.StartupDelay, next)
+	}
+
+	waitFor(t, func() bool { return fe.count.Load() == 1 })
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our last snapshot is recent, we should wait for the schedule
+	fe, s = start()
+	time.Sleep(cfg.StartupDelay * 3)
+	if count := fe.count.Load(); count != 0 {
+		t.Fatalf("invalid number of copies, expected %d and received %d", 0, count)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our last snapshot is older than the interval, we should catch up
+	old := DefaultKeyCodec.Encode("test", "txt", time.Now().Add(-Hour*2))
+	ss := &Snapshotter{be: be, cfg: cfg, codec: DefaultKeyCodec}
+	if err := ss.setLatest(context.Background(), old); err != nil {
+		t.Fatal(err)
+	}
+
+	fe, s = start()
+	defer s.Close()
+	waitFor(t, func() bool { return fe.count.Load() == 1 })
+}
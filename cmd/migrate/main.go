@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gdbu/snapshotter"
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/scribe"
+)
+
+func main() {
+	var (
+		be    snapshotter.Backend
+		codec snapshotter.KeyFormat
+
+		backendType string
+		dir         string
+		s3Path      string
+		bucket      string
+		name        string
+		ext         string
+		layout      string
+		timestamp   string
+		signingKey  string
+
+		key ed25519.PrivateKey
+		err error
+	)
+
+	flag.StringVar(&backendType, "backend", "s3", "Back-end type, either \"file\" or \"s3\"")
+	flag.StringVar(&dir, "dir", "./backend", "Directory of the file back-end")
+	flag.StringVar(&s3Path, "s3", "./cfg/s3.toml", "Path of the S3 configuration file")
+	flag.StringVar(&bucket, "bucket", "", "Target Amazon S3 bucket")
+	flag.StringVar(&name, "name", "", "Snapshotter name of the keys to migrate")
+	flag.StringVar(&ext, "ext", "", "Snapshotter extension of the keys to migrate")
+	flag.StringVar(&layout, "layout", "flat", "Target key layout, one of \"flat\", \"year\", \"month\" or \"day\"")
+	flag.StringVar(&timestamp, "timestamp", "unix", "Target key timestamp format, either \"unix\" or \"iso8601\"")
+	flag.StringVar(&signingKey, "signingKey", "", "Path of the Ed25519 signing key used to re-sign signed snapshots")
+	flag.Parse()
+
+	out := scribe.New("Snapshot key migration")
+
+	if len(name) == 0 || len(ext) == 0 {
+		out.Error("Name and extension must be provided")
+		os.Exit(1)
+	}
+
+	if codec, err = newKeyFormat(layout, timestamp); err != nil {
+		out.Errorf("Error parsing key format: %v", err)
+		os.Exit(1)
+	}
+
+	if be, err = newBackend(backendType, dir, s3Path, bucket); err != nil {
+		out.Errorf("Error creating back-end: %v", err)
+		os.Exit(1)
+	}
+
+	if len(signingKey) > 0 {
+		if key, err = snapshotter.LoadSigningKey(signingKey); err != nil {
+			out.Errorf("Error loading signing key: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	var renamed int
+	if err = snapshotter.MigrateKeys(context.Background(), be, name, ext, codec, key, func(oldKey, newKey string) (err error) {
+		out.Successf("Renamed \"%s\" to \"%s\"", oldKey, newKey)
+		renamed++
+		return
+	}); err != nil {
+		out.Errorf("Error migrating keys: %v", err)
+		os.Exit(1)
+	}
+
+	out.Notificationf("Migrated %d snapshots", renamed)
+}
+
+func newKeyFormat(layout, timestamp string) (codec snapshotter.KeyFormat, err error) {
+	switch layout {
+	case "flat":
+		codec.Layout = snapshotter.LayoutFlat
+	case "year":
+		codec.Layout = snapshotter.LayoutYear
+	case "month":
+		codec.Layout = snapshotter.LayoutMonth
+	case "day":
+		codec.Layout = snapshotter.LayoutDay
+
+	default:
+		err = fmt.Errorf("invalid layout \"%s\"", layout)
+		return
+	}
+
+	switch timestamp {
+	case "unix":
+		codec.Timestamp = snapshotter.TimestampUnix
+	case "iso8601":
+		codec.Timestamp = snapshotter.TimestampISO8601
+
+	default:
+		err = fmt.Errorf("invalid timestamp format \"%s\"", timestamp)
+	}
+
+	return
+}
+
+func newBackend(backendType, dir, s3Path, bucket string) (be snapshotter.Backend, err error) {
+	switch backendType {
+	case "file":
+		return backends.NewFile(dir), nil
+	case "s3":
+		var s3cfg backends.S3Config
+		if s3cfg, err = backends.NewS3Config(s3Path); err != nil {
+			return
+		}
+
+		return backends.NewS3(s3cfg.Config(), bucket)
+
+	default:
+		return nil, fmt.Errorf("invalid back-end type \"%s\"", backendType)
+	}
+}
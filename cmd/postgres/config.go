@@ -21,4 +21,28 @@ type Config struct {
 	Bucket string `toml:"bucket"`
 	// Interval in minutes
 	Interval time.Duration `toml:"interval"`
+	// Optional cron expression, takes precedence over Interval when set
+	Schedule string `toml:"schedule"`
+	// Maximum random delay in seconds added to each scheduled snapshot
+	Jitter time.Duration `toml:"jitter"`
+	// Snapshot on startup if a scheduled snapshot was missed while the service was down
+	CatchUp bool `toml:"catchUp"`
+	// Delay in seconds before the catch-up snapshot
+	StartupDelay time.Duration `toml:"startupDelay"`
+	// Time zone snapshot times are truncated within (e.g. "America/New_York"), defaults to UTC
+	Location string `toml:"location"`
+	// Address to serve prometheus metrics on (e.g. ":9100"), metrics are disabled when empty
+	MetricsAddr string `toml:"metricsAddr"`
+	// Path of the Ed25519 key used to sign snapshots, signing is disabled when empty
+	SigningKey string `toml:"signingKey"`
+	// Paths of the Ed25519 public keys trusted when loading snapshots
+	TrustedKeys []string `toml:"trustedKeys"`
+	// Local directory snapshots are spooled to while S3 is unavailable, spooling is disabled when empty
+	SpoolDir string `toml:"spoolDir"`
+	// Maximum size of the spool in megabytes, the spool is unbounded when zero
+	SpoolMaxSize int64 `toml:"spoolMaxSize"`
+	// Local directory snapshots are replicated to alongside S3, replication is disabled when empty
+	ReplicaDir string `toml:"replicaDir"`
+	// Number of replicas which must succeed when replicating, zero requires every replica
+	Quorum int `toml:"quorum"`
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
+	"net/http"
 	"path"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 
 	"github.com/gdbu/snapshotter"
 	"github.com/gdbu/snapshotter/backends"
+	"github.com/gdbu/snapshotter/metrics"
 	"github.com/hatchify/closer"
 	"github.com/hatchify/scribe"
 )
@@ -21,7 +25,9 @@ func main() {
 		fe snapshotter.Frontend
 		be snapshotter.Backend
 
-		cfgPath string
+		cfgPath   string
+		dryRun    bool
+		restoreAt string
 
 		cfg   Config
 		pgcfg pgutils.Config
@@ -32,6 +38,8 @@ func main() {
 	)
 
 	flag.StringVar(&cfgPath, "config", "./cfg", "Path of configuration files")
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the purge plan instead of deleting snapshots")
+	flag.StringVar(&restoreAt, "restore-at", "", "Restore the most recent snapshot taken at or before the provided RFC 3339 timestamp, then exit")
 	flag.Parse()
 
 	out := scribe.New("Postgres snapshotter")
@@ -55,7 +63,37 @@ func main() {
 	sscfg.Extension = "sql"
 	sscfg.Name = cfg.Name
 	sscfg.Interval = cfg.Interval * time.Minute
+	sscfg.Schedule = cfg.Schedule
+	sscfg.Jitter = cfg.Jitter * time.Second
+	sscfg.CatchUp = cfg.CatchUp
+	sscfg.StartupDelay = cfg.StartupDelay * time.Second
 	sscfg.Truncate = time.Hour
+	sscfg.Logger = snapshotter.NewScribeLogger(out)
+	sscfg.DryRun = dryRun
+
+	if len(cfg.Location) > 0 {
+		if sscfg.Location, err = time.LoadLocation(cfg.Location); err != nil {
+			out.Errorf("Error loading location: %v", err)
+			return
+		}
+	}
+
+	if len(cfg.SigningKey) > 0 {
+		if sscfg.SigningKey, err = snapshotter.LoadSigningKey(cfg.SigningKey); err != nil {
+			out.Errorf("Error loading signing key: %v", err)
+			return
+		}
+	}
+
+	for _, filename := range cfg.TrustedKeys {
+		var key ed25519.PublicKey
+		if key, err = snapshotter.LoadPublicKey(filename); err != nil {
+			out.Errorf("Error loading trusted key: %v", err)
+			return
+		}
+
+		sscfg.TrustedKeys = append(sscfg.TrustedKeys, key)
+	}
 
 	fe = frontends.NewPostgres(pgcfg)
 
@@ -66,8 +104,53 @@ func main() {
 		return
 	}
 
-	if s, err = snapshotter.New(fe, be, sscfg); err != nil {
-		out.Errorf("Error starting snapshotter:", err)
+	if len(cfg.SpoolDir) > 0 {
+		var sb *snapshotter.SpoolingBackend
+		opts := snapshotter.SpoolOptions{MaxBytes: cfg.SpoolMaxSize * 1024 * 1024, Logger: sscfg.Logger}
+		if sb, err = snapshotter.NewSpoolingBackend(be, cfg.SpoolDir, opts); err != nil {
+			out.Errorf("Error creating spool: %v", err)
+			return
+		}
+		defer sb.Close()
+
+		be = sb
+	}
+
+	if len(cfg.ReplicaDir) > 0 {
+		var mb *snapshotter.MultiBackend
+		// The local replica is listed first, so restores are served locally when possible
+		if mb, err = snapshotter.NewMultiBackend(snapshotter.MultiOptions{Quorum: cfg.Quorum}, backends.NewFile(cfg.ReplicaDir), be); err != nil {
+			out.Errorf("Error creating replicated backend: %v", err)
+			return
+		}
+
+		mb.OnReplicaError(func(replica int, key string, err error) {
+			out.Warningf("Error replicating \"%s\" to replica %d: %v", key, replica, err)
+		})
+
+		be = mb
+	}
+
+	if len(restoreAt) > 0 {
+		// Restore without starting a snapshotter, so no snapshots or purges run during the restore
+		restore(out, fe, be, sscfg, restoreAt)
+		return
+	}
+
+	if s, err = snapshotter.NewUnstarted(context.Background(), fe, be, sscfg); err != nil {
+		out.Errorf("Error creating snapshotter: %v", err)
+		return
+	}
+
+	if len(cfg.MetricsAddr) > 0 {
+		// Watch before starting, so snapshots which run as we start (e.g. catch-up) are recorded
+		m := metrics.New()
+		m.Watch(s)
+		go serveMetrics(out, m, cfg.MetricsAddr)
+	}
+
+	if err = s.Start(); err != nil {
+		out.Errorf("Error starting snapshotter: %v", err)
 		return
 	}
 
@@ -76,3 +159,36 @@ func main() {
 	out.Notification("Closing service, see you again soon!")
 	s.Close()
 }
+
+// restore will restore the database from the most recent snapshot taken at or before the provided timestamp
+func restore(out *scribe.Scribe, fe snapshotter.Frontend, be snapshotter.Backend, cfg snapshotter.Config, timestamp string) {
+	var (
+		t   time.Time
+		key string
+		err error
+	)
+
+	if t, err = time.Parse(time.RFC3339, timestamp); err != nil {
+		out.Errorf("Error parsing restore timestamp: %v", err)
+		return
+	}
+
+	out.Notificationf("Restoring from the most recent snapshot at or before %s", timestamp)
+	if key, err = snapshotter.RestoreAt(context.Background(), fe, be, cfg, t); err != nil {
+		out.Errorf("Error restoring from %s: %v", timestamp, err)
+		return
+	}
+
+	out.Successf("Restored from \"%s\"", key)
+}
+
+// serveMetrics will serve the snapshotter metrics on the provided address
+func serveMetrics(out *scribe.Scribe, m *metrics.Metrics, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+
+	out.Notificationf("Serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		out.Errorf("Error serving metrics: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/gdbu/snapshotter"
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/scribe"
+)
+
+func main() {
+	var (
+		be snapshotter.Backend
+		kr *snapshotter.Keyring
+
+		backendType string
+		dir         string
+		s3Path      string
+		bucket      string
+		keyringDir  string
+		currentID   string
+		prefix      string
+		statePath   string
+
+		err error
+	)
+
+	flag.StringVar(&backendType, "backend", "s3", "Back-end type, either \"file\" or \"s3\"")
+	flag.StringVar(&dir, "dir", "./backend", "Directory of the file back-end")
+	flag.StringVar(&s3Path, "s3", "./cfg/s3.toml", "Path of the S3 configuration file")
+	flag.StringVar(&bucket, "bucket", "", "Target Amazon S3 bucket")
+	flag.StringVar(&keyringDir, "keyring", "./keys", "Directory of key files, each file name is used as the key ID")
+	flag.StringVar(&currentID, "current", "", "ID of the key to re-encrypt snapshots with")
+	flag.StringVar(&prefix, "prefix", "", "Prefix of the keys to re-encrypt")
+	flag.StringVar(&statePath, "state", "./reencrypt.state", "Path of the file used to resume an interrupted run")
+	flag.Parse()
+
+	out := scribe.New("Snapshot re-encryption")
+
+	if kr, err = snapshotter.LoadKeyring(keyringDir, currentID); err != nil {
+		out.Errorf("Error loading keyring: %v", err)
+		os.Exit(1)
+	}
+
+	if be, err = newBackend(backendType, dir, s3Path, bucket); err != nil {
+		out.Errorf("Error creating back-end: %v", err)
+		os.Exit(1)
+	}
+
+	var marker string
+	// Resume from the last visited key (if a previous run was interrupted)
+	if bs, err := ioutil.ReadFile(statePath); err == nil {
+		marker = strings.TrimSpace(string(bs))
+		out.Notificationf("Resuming after \"%s\"", marker)
+	}
+
+	var rotated, skipped int
+	eb := snapshotter.NewKeyringBackend(be, kr)
+	if err = eb.Reencrypt(context.Background(), prefix, marker, func(key string, ok bool) (err error) {
+		if ok {
+			out.Successf("Re-encrypted \"%s\"", key)
+			rotated++
+		} else {
+			skipped++
+		}
+
+		// Persist our progress so an interrupted run can be resumed
+		return ioutil.WriteFile(statePath, []byte(key), 0644)
+	}); err != nil {
+		out.Errorf("Error re-encrypting: %v", err)
+		os.Exit(1)
+	}
+
+	// Run has completed, remove our state so the next run starts from the beginning
+	os.Remove(statePath)
+	out.Notificationf("Re-encrypted %d snapshots using key \"%s\" (%d skipped)", rotated, currentID, skipped)
+}
+
+func newBackend(backendType, dir, s3Path, bucket string) (be snapshotter.Backend, err error) {
+	switch backendType {
+	case "file":
+		return backends.NewFile(dir), nil
+	case "s3":
+		var s3cfg backends.S3Config
+		if s3cfg, err = backends.NewS3Config(s3Path); err != nil {
+			return
+		}
+
+		return backends.NewS3(s3cfg.Config(), bucket)
+
+	default:
+		return nil, fmt.Errorf("invalid back-end type \"%s\"", backendType)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdbu/snapshotter"
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/scribe"
+)
+
+func main() {
+	var (
+		be      snapshotter.Backend
+		trusted []ed25519.PublicKey
+
+		backendType string
+		dir         string
+		s3Path      string
+		bucket      string
+		trustedKeys string
+		keyringDir  string
+		currentID   string
+		decompress  bool
+
+		err error
+	)
+
+	flag.StringVar(&backendType, "backend", "s3", "Back-end type, either \"file\" or \"s3\"")
+	flag.StringVar(&dir, "dir", "./backend", "Directory of the file back-end")
+	flag.StringVar(&s3Path, "s3", "./cfg/s3.toml", "Path of the S3 configuration file")
+	flag.StringVar(&bucket, "bucket", "", "Target Amazon S3 bucket")
+	flag.StringVar(&trustedKeys, "trusted", "", "Comma separated paths of trusted Ed25519 public keys")
+	flag.StringVar(&keyringDir, "keyring", "", "Directory of encryption key files, leave empty if snapshots are not encrypted")
+	flag.StringVar(&currentID, "current", "", "ID of any key within the keyring")
+	flag.BoolVar(&decompress, "decompress", false, "Decompress snapshots which were compressed by a back-end decorator")
+	flag.Parse()
+
+	out := scribe.New("Snapshot verification")
+
+	if flag.NArg() == 0 {
+		out.Error("At least one snapshot key must be provided")
+		os.Exit(1)
+	}
+
+	for _, filename := range strings.Split(trustedKeys, ",") {
+		if len(filename) == 0 {
+			continue
+		}
+
+		var key ed25519.PublicKey
+		if key, err = snapshotter.LoadPublicKey(filename); err != nil {
+			out.Errorf("Error loading trusted key: %v", err)
+			os.Exit(1)
+		}
+
+		trusted = append(trusted, key)
+	}
+
+	if len(trusted) == 0 {
+		out.Error("At least one trusted key must be provided")
+		os.Exit(1)
+	}
+
+	if be, err = newBackend(backendType, dir, s3Path, bucket, keyringDir, currentID, decompress); err != nil {
+		out.Errorf("Error creating back-end: %v", err)
+		os.Exit(1)
+	}
+
+	var failed int
+	for _, key := range flag.Args() {
+		if err = snapshotter.VerifySnapshot(context.Background(), be, key, trusted); err != nil {
+			out.Errorf("Error verifying \"%s\": %v", key, err)
+			failed++
+			continue
+		}
+
+		out.Successf("Verified \"%s\"", key)
+	}
+
+	if failed > 0 {
+		out.Errorf("%d of %d snapshots failed verification", failed, flag.NArg())
+		os.Exit(1)
+	}
+}
+
+func newBackend(backendType, dir, s3Path, bucket, keyringDir, currentID string, decompress bool) (be snapshotter.Backend, err error) {
+	switch backendType {
+	case "file":
+		be = backends.NewFile(dir)
+	case "s3":
+		var s3cfg backends.S3Config
+		if s3cfg, err = backends.NewS3Config(s3Path); err != nil {
+			return
+		}
+
+		if be, err = backends.NewS3(s3cfg.Config(), bucket); err != nil {
+			return
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid back-end type \"%s\"", backendType)
+	}
+
+	if len(keyringDir) > 0 {
+		// Snapshots are encrypted, decrypt before verifying
+		var kr *snapshotter.Keyring
+		if kr, err = snapshotter.LoadKeyring(keyringDir, currentID); err != nil {
+			return
+		}
+
+		be = snapshotter.NewKeyringBackend(be, kr)
+	}
+
+	if decompress {
+		// Compressed back-ends read the codec from the header of the stored value, the codec provided here only applies to writes
+		if be, err = snapshotter.NewCompressedBackend(be, snapshotter.CodecGzip, 0); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,129 @@
+package snapshotter
+
+import (
+	"context"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrInvalidCollisionPolicy is returned when an invalid collision policy is set
+const ErrInvalidCollisionPolicy = errors.Error("invalid collision policy, sequence policies require a KeyCodec which implements SequenceCodec")
+
+// CollisionPolicy determines what occurs when a snapshot's key already exists. This happens
+// when more than one snapshot is taken within the same truncated time (e.g. an Interval of one
+// minute with a Truncate of one hour)
+type CollisionPolicy uint8
+
+const (
+	// CollisionOverwrite will overwrite the existing snapshot
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionSkip will skip the snapshot, keeping the existing snapshot
+	CollisionSkip
+	// CollisionSequence will append an increasing sequence number to the key, keeping every snapshot
+	CollisionSequence
+)
+
+// Validate will ensure the collision policy is supported by the provided codec
+func (c CollisionPolicy) Validate(codec KeyCodec) (err error) {
+	switch c {
+	case CollisionOverwrite, CollisionSkip:
+		return
+	case CollisionSequence:
+		if _, ok := codec.(SequenceCodec); ok {
+			return
+		}
+	}
+
+	return ErrInvalidCollisionPolicy
+}
+
+// String will return the name of the collision policy
+func (c CollisionPolicy) String() string {
+	switch c {
+	case CollisionOverwrite:
+		return "overwrite"
+	case CollisionSkip:
+		return "skip"
+	case CollisionSequence:
+		return "sequence"
+
+	default:
+		return "invalid"
+	}
+}
+
+// newKey will return the key for a snapshot taken at the provided time according to our collision policy
+// Note: False is returned when the snapshot should be skipped
+func (s *Snapshotter) newKey(ctx context.Context, t time.Time) (key string, ok bool, err error) {
+	key = s.codec.Encode(s.cfg.Name, s.cfg.Extension, t)
+	switch s.cfg.CollisionPolicy {
+	case CollisionSkip:
+		var exists bool
+		if exists, err = keyExists(ctx, s.be, key); err != nil {
+			return
+		}
+
+		return key, !exists, nil
+	case CollisionSequence:
+		return s.nextSequenceKey(ctx, t)
+
+	default:
+		return key, true, nil
+	}
+}
+
+// nextSequenceKey will return the key following the highest sequence number in use for the provided time
+func (s *Snapshotter) nextSequenceKey(ctx context.Context, t time.Time) (key string, ok bool, err error) {
+	codec := s.codec.(SequenceCodec)
+	prefix := s.codec.Marker(s.cfg.Name, t)
+
+	var (
+		marker string
+		next   int
+	)
+
+	for {
+		var keys []string
+		if keys, err = list(ctx, s.be, prefix, marker, purgePageSize); err != nil {
+			return
+		}
+
+		for _, k := range keys {
+			if isSidecar(k) {
+				continue
+			}
+
+			name, ext, kt, seq, derr := codec.DecodeSequence(k)
+			if derr != nil || name != s.cfg.Name || ext != s.cfg.Extension || !kt.Equal(t) {
+				// Key does not share our time, continue
+				continue
+			}
+
+			if seq >= next {
+				next = seq + 1
+			}
+		}
+
+		if len(keys) < purgePageSize {
+			break
+		}
+
+		// Set marker as the last key we've seen
+		marker = keys[len(keys)-1]
+	}
+
+	return codec.EncodeSequence(s.cfg.Name, s.cfg.Extension, t, next), true, nil
+}
+
+// keyExists will determine if the provided key exists within the back-end
+// Note: Listing is used rather than reading, so the value does not need to be downloaded
+func keyExists(ctx context.Context, be Backend, key string) (exists bool, err error) {
+	var keys []string
+	if keys, err = list(ctx, be, key, "", 1); err != nil {
+		return
+	}
+
+	// Keys are listed in order, so the key itself precedes any keys it prefixes (e.g. sidecars)
+	return len(keys) > 0 && keys[0] == key, nil
+}
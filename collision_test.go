@@ -0,0 +1,116 @@
+package snapshotter
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestSnapshotter_CollisionPolicy(t *testing.T) {
+	tcs := []struct {
+		policy CollisionPolicy
+		keys   int
+		copies int64
+	}{
+		{policy: CollisionOverwrite, keys: 1, copies: 3},
+		{policy: CollisionSkip, keys: 1, copies: 1},
+		{policy: CollisionSequence, keys: 3, copies: 3},
+	}
+
+	for _, tc := range tcs {
+		testCollisionPolicy(t, tc.policy, tc.keys, tc.copies)
+	}
+}
+
+func testCollisionPolicy(t *testing.T, policy CollisionPolicy, expectedKeys int, expectedCopies int64) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	fe := &testFrontend{}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshots will run
+	cfg.Interval = Hour
+	// Truncate to a year so each of our snapshots share the same truncated time
+	cfg.Truncate = Year
+	// Disable the TTL so the purge loop keeps our year-old truncated snapshots
+	cfg.TTL = 0
+	cfg.CollisionPolicy = policy
+
+	if s, err = New(fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		if err = s.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := fe.count.Load(); count != expectedCopies {
+		t.Fatalf("invalid number of copies for %s, expected %d and received %d", policy, expectedCopies, count)
+	}
+
+	var entries []snapshotEntry
+	if entries, _, err = s.listEntries(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != expectedKeys {
+		t.Fatalf("invalid number of keys for %s, expected %d and received %d", policy, expectedKeys, len(entries))
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	codec := s.codec.(SequenceCodec)
+	_, _, _, seq, err := codec.DecodeSequence(latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seq != expectedKeys-1 {
+		t.Fatalf("invalid latest sequence for %s, expected %d and received %d", policy, expectedKeys-1, seq)
+	}
+
+	var keyTime time.Time
+	if keyTime, err = s.KeyTime(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := getTruncated(time.Now().UTC(), Year); !keyTime.Equal(expected) {
+		t.Fatalf("invalid key time for %s, expected %v and received %v", policy, expected, keyTime)
+	}
+}
+
+func TestCollisionPolicy_Validate(t *testing.T) {
+	if err := CollisionSequence.Validate(DefaultKeyCodec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CollisionSequence.Validate(testKeyCodec{}); err != ErrInvalidCollisionPolicy {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidCollisionPolicy, err)
+	}
+
+	if err := CollisionPolicy(42).Validate(DefaultKeyCodec); err != ErrInvalidCollisionPolicy {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidCollisionPolicy, err)
+	}
+}
+
+// testKeyCodec is a KeyCodec which does not support sequences
+type testKeyCodec struct {
+	KeyCodec
+}
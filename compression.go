@@ -0,0 +1,310 @@
+package snapshotter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/hatchify/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ErrInvalidCodec is returned when an unsupported compression codec is provided
+	ErrInvalidCodec = errors.Error("invalid compression codec, must be gzip or zstd")
+)
+
+// errNoCompressionHeader is returned when a value does not begin with a compression header
+const errNoCompressionHeader = errors.Error("value does not have a compression header")
+
+const (
+	// CodecGzip compresses snapshots using gzip
+	CodecGzip Codec = "gzip"
+	// CodecZstd compresses snapshots using zstd
+	CodecZstd Codec = "zstd"
+)
+
+// compressionMagic is the leading bytes of every value written by a CompressedBackend, it is
+// followed by a single byte identifying the codec
+var compressionMagic = []byte("SSCMP")
+
+const (
+	// compressionIDGzip identifies gzip within a compression header
+	compressionIDGzip byte = 1
+	// compressionIDZstd identifies zstd within a compression header
+	compressionIDZstd byte = 2
+)
+
+// Codec represents a compression codec
+type Codec string
+
+// Validate will validate a Codec
+func (c Codec) Validate() (err error) {
+	switch c {
+	case CodecGzip:
+	case CodecZstd:
+	default:
+		return ErrInvalidCodec
+	}
+
+	return
+}
+
+// NewCompressedFrontend will return a front-end which compresses the output of the provided front-end
+// Note: A level of zero will use the default level of the codec
+func NewCompressedFrontend(fe Frontend, codec Codec, level int) (cp *CompressedFrontend, err error) {
+	if err = codec.Validate(); err != nil {
+		return
+	}
+
+	var c CompressedFrontend
+	c.fe = fe
+	c.codec = codec
+	c.level = level
+	cp = &c
+	return
+}
+
+// CompressedFrontend is a front-end decorator which compresses snapshots as they are copied
+// Note: The codec is recorded within the snapshot manifest, Snapshotter.Load will transparently
+// decompress snapshots produced by this front-end
+type CompressedFrontend struct {
+	fe    Frontend
+	codec Codec
+	level int
+}
+
+// Copy will copy the compressed output of the underlying front-end to an io.Writer
+func (c *CompressedFrontend) Copy(w io.Writer) (err error) {
+	return c.CopyContext(context.Background(), w)
+}
+
+// CopyContext will copy the compressed output of the underlying front-end to an io.Writer
+func (c *CompressedFrontend) CopyContext(ctx context.Context, w io.Writer) (err error) {
+	var cw io.WriteCloser
+	if cw, err = newCompressWriter(w, c.codec, c.level); err != nil {
+		return
+	}
+
+	if err = copyTo(ctx, c.fe, cw); err != nil {
+		cw.Close()
+		return
+	}
+
+	// Close the compressor to flush the remaining bytes
+	return cw.Close()
+}
+
+// Compression will return the compression codec
+func (c *CompressedFrontend) Compression() string {
+	return string(c.codec)
+}
+
+// Unwrap will return the underlying front-end
+func (c *CompressedFrontend) Unwrap() Frontend {
+	return c.fe
+}
+
+// NewCompressedBackend will return a back-end which compresses snapshots before passing them to the provided back-end
+// Note: A level of zero will use the default level of the codec
+func NewCompressedBackend(be Backend, codec Codec, level int) (cp *CompressedBackend, err error) {
+	if err = codec.Validate(); err != nil {
+		return
+	}
+
+	var c CompressedBackend
+	c.be = be
+	c.codec = codec
+	c.level = level
+	cp = &c
+	return
+}
+
+// CompressedBackend is a back-end decorator which compresses on write and decompresses on read
+// Note: Compressed values begin with a header identifying their codec, values without the header
+// (such as those written before compression was enabled) are read as-is
+type CompressedBackend struct {
+	be    Backend
+	codec Codec
+	level int
+}
+
+// WriteTo will pass a compressing writer to the provided function
+func (c *CompressedBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return c.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will pass a compressing writer to the provided function
+func (c *CompressedBackend) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	return writeTo(ctx, c.be, key, func(w io.Writer) (err error) {
+		if _, err = w.Write(newCompressionHeader(c.codec)); err != nil {
+			return
+		}
+
+		var cw io.WriteCloser
+		if cw, err = newCompressWriter(w, c.codec, c.level); err != nil {
+			return
+		}
+
+		if err = fn(cw); err != nil {
+			cw.Close()
+			return
+		}
+
+		// Close the compressor to flush the remaining bytes
+		return cw.Close()
+	})
+}
+
+// ReadFrom will pass a decompressing reader to the provided function
+func (c *CompressedBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return c.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will pass a decompressing reader to the provided function
+func (c *CompressedBackend) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	return readFrom(ctx, c.be, key, func(r io.Reader) (err error) {
+		br := bufio.NewReader(r)
+
+		var codec Codec
+		if codec, err = readCompressionHeader(br); err == errNoCompressionHeader {
+			// Value was not written by a compressed back-end, pass it through as-is
+			return fn(br)
+		} else if err != nil {
+			return
+		}
+
+		return decompressFn(codec, fn)(br)
+	})
+}
+
+// Delete will delete a key
+func (c *CompressedBackend) Delete(key string) (err error) {
+	return c.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will delete a key
+func (c *CompressedBackend) DeleteContext(ctx context.Context, key string) (err error) {
+	return deleteKey(ctx, c.be, key)
+}
+
+// List will list the available keys
+func (c *CompressedBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return c.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the available keys
+func (c *CompressedBackend) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return list(ctx, c.be, prefix, marker, maxKeys)
+}
+
+// Next will return the next key
+func (c *CompressedBackend) Next(prefix, marker string) (key string, err error) {
+	return c.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key
+func (c *CompressedBackend) NextContext(ctx context.Context, prefix, marker string) (key string, err error) {
+	return next(ctx, c.be, prefix, marker)
+}
+
+// Compression will return the compression codec
+func (c *CompressedBackend) Compression() string {
+	return string(c.codec)
+}
+
+// Unwrap will return the underlying back-end
+func (c *CompressedBackend) Unwrap() Backend {
+	return c.be
+}
+
+// newCompressWriter will return a writer which compresses to the provided writer
+func newCompressWriter(w io.Writer, codec Codec, level int) (cw io.WriteCloser, err error) {
+	switch codec {
+	case CodecGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		return gzip.NewWriterLevel(w, level)
+	case CodecZstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+
+		return zstd.NewWriter(w, opts...)
+
+	default:
+		return nil, ErrInvalidCodec
+	}
+}
+
+// newDecompressReader will return a reader which decompresses the provided reader using the provided codec
+func newDecompressReader(r io.Reader, codec Codec) (rc io.ReadCloser, err error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZstd:
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(r); err != nil {
+			return
+		}
+
+		return d.IOReadCloser(), nil
+
+	default:
+		return nil, ErrInvalidCodec
+	}
+}
+
+// decompressFn will wrap the provided function so that it receives a reader decompressed using the provided codec
+func decompressFn(codec Codec, fn func(io.Reader) error) func(io.Reader) error {
+	return func(r io.Reader) (err error) {
+		var rc io.ReadCloser
+		if rc, err = newDecompressReader(r, codec); err != nil {
+			return
+		}
+		defer rc.Close()
+
+		return fn(rc)
+	}
+}
+
+// newCompressionHeader will return the header written before a value compressed using the provided codec
+func newCompressionHeader(codec Codec) (header []byte) {
+	header = append(header, compressionMagic...)
+	switch codec {
+	case CodecGzip:
+		return append(header, compressionIDGzip)
+	default:
+		return append(header, compressionIDZstd)
+	}
+}
+
+// readCompressionHeader will read the compression header and return the codec it identifies
+// Note: The reader is not advanced when the value does not begin with a compression header
+func readCompressionHeader(br *bufio.Reader) (codec Codec, err error) {
+	// Peek errors are ignored as short values cannot have a header
+	header, _ := br.Peek(len(compressionMagic) + 1)
+	if len(header) < len(compressionMagic)+1 || !bytes.HasPrefix(header, compressionMagic) {
+		err = errNoCompressionHeader
+		return
+	}
+
+	switch header[len(compressionMagic)] {
+	case compressionIDGzip:
+		codec = CodecGzip
+	case compressionIDZstd:
+		codec = CodecZstd
+
+	default:
+		err = ErrInvalidCodec
+		return
+	}
+
+	_, err = br.Discard(len(header))
+	return
+}
@@ -0,0 +1,224 @@
+package snapshotter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestCompression(t *testing.T) {
+	for _, codec := range []Codec{CodecGzip, CodecZstd} {
+		cfe, err := NewCompressedFrontend(&testFrontend{}, codec, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testCompression(t, cfe, backends.NewFile(backendTestDir))
+
+		cbe, err := NewCompressedBackend(backends.NewFile(backendTestDir), codec, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testCompression(t, &testFrontend{}, cbe)
+	}
+
+	if _, err := NewCompressedBackend(backends.NewFile(backendTestDir), "lz4", 0); err != ErrInvalidCodec {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidCodec, err)
+	}
+}
+
+func TestCompressedBackend_Uncompressed(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+
+	// Write an uncompressed value directly to the underlying back-end
+	be := backends.NewFile(backendTestDir)
+	if err := be.WriteTo("test.txt", func(w io.Writer) (err error) {
+		_, err = w.Write([]byte("hello world"))
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cbe, err := NewCompressedBackend(be, CodecZstd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cbe.ReadFrom("test.txt", confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompression_CompressedPayload(t *testing.T) {
+	// Create a payload which is already gzipped (e.g. a tar.gz dump)
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte("hello world"))
+	gw.Close()
+	payload := buf.Bytes()
+
+	confirmPayload := func(r io.Reader) (err error) {
+		var bs []byte
+		if bs, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+
+		if !bytes.Equal(bs, payload) {
+			return fmt.Errorf("invalid value, expected the gzipped payload and received %q", bs)
+		}
+
+		return
+	}
+
+	for _, codec := range []Codec{CodecGzip, CodecZstd} {
+		func() {
+			// Defer the removal of our backend test directory
+			defer os.RemoveAll(backendTestDir)
+			be := backends.NewFile(backendTestDir)
+			cbe, err := NewCompressedBackend(be, codec, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Values which are not compressed by the back-end are read as-is, even when they look compressed
+			if err = be.WriteTo("test.raw.txt", func(w io.Writer) (err error) {
+				_, err = w.Write(payload)
+				return
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = cbe.ReadFrom("test.raw.txt", confirmPayload); err != nil {
+				t.Fatal(err)
+			}
+
+			// Compressed payloads are only decompressed once by the back-end
+			if err = cbe.WriteTo("test.compressed.txt", func(w io.Writer) (err error) {
+				_, err = w.Write(payload)
+				return
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = cbe.ReadFrom("test.compressed.txt", confirmPayload); err != nil {
+				t.Fatal(err)
+			}
+		}()
+	}
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	cbe, err := NewCompressedBackend(backends.NewFile(backendTestDir), CodecGzip, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "tar.gz")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	var s *Snapshotter
+	if s, err = New(&testPayloadFrontend{payload: payload}, cbe, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots compressed by a back-end are only decompressed by the back-end
+	if err = s.Load(latest, confirmPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots compressed by both a front-end and a back-end are decompressed once by each
+	var cfe *CompressedFrontend
+	if cfe, err = NewCompressedFrontend(&testFrontend{}, CodecGzip, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	testCompression(t, cfe, cbe)
+}
+
+func testCompression(t *testing.T, fe Frontend, be Backend) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the stored bytes have been compressed
+	var stored []byte
+	if stored, err = ioutil.ReadFile(path.Join(backendTestDir, latest)); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(stored, []byte("hello world")) {
+		t.Fatal("expected stored snapshot to be compressed")
+	}
+
+	if err = s.Load(latest, confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testPayloadFrontend is a front-end which copies a fixed payload
+type testPayloadFrontend struct {
+	payload []byte
+}
+
+// Copy will copy the payload to an io.Writer
+func (f *testPayloadFrontend) Copy(w io.Writer) (err error) {
+	_, err = w.Write(f.payload)
+	return
+}
+
+func confirmHelloWorld(r io.Reader) (err error) {
+	var bs []byte
+	if bs, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+
+	if string(bs) != "hello world" {
+		return fmt.Errorf("invalid value, expected \"%s\" and received \"%s\"", "hello world", string(bs))
+	}
+
+	return
+}
@@ -1,6 +1,7 @@
 package snapshotter
 
 import (
+	"crypto/ed25519"
 	"time"
 
 	"github.com/hatchify/errors"
@@ -13,6 +14,7 @@ func NewConfig(name, ext string) (cfg Config) {
 	cfg.Interval = Minute
 	cfg.Truncate = Hour
 	cfg.TTL = Month
+	cfg.CloseTimeout = Minute
 	return
 }
 
@@ -23,6 +25,108 @@ type Config struct {
 	Interval  time.Duration
 	Truncate  time.Duration
 	TTL       time.Duration
+
+	// Location is the time zone snapshot times are truncated within (e.g. the start of a day)
+	// and cron schedules are evaluated within (e.g. "0 2 * * *" runs at 02:00 in this location)
+	// Note: When nil, UTC is used
+	Location *time.Location
+
+	// KeyCodec determines the keys snapshots are stored under
+	// Note: When nil, DefaultKeyCodec is used
+	KeyCodec KeyCodec
+
+	// CollisionPolicy determines what occurs when a snapshot's key already exists
+	// Note: The zero value overwrites the existing snapshot
+	CollisionPolicy CollisionPolicy
+
+	// Retention is the retention policy applied during purges
+	// Note: When empty, a policy keeping all snapshots newer than TTL is used
+	Retention RetentionPolicy
+	// DryRun will log the purge plan rather than deleting from the back-end
+	DryRun bool
+
+	// Schedule is an optional cron expression (e.g. "0 */6 * * *") which determines when
+	// snapshots occur. When set, Interval is ignored
+	Schedule string
+	// Jitter is the maximum random delay added to each scheduled snapshot
+	Jitter time.Duration
+
+	// CatchUp will snapshot on startup if a scheduled snapshot was missed since the last
+	// successful snapshot (e.g. while the service was down or being redeployed)
+	CatchUp bool
+	// StartupDelay is how long to wait before the catch-up snapshot
+	StartupDelay time.Duration
+
+	// OverrunPolicy determines what occurs when a scheduled snapshot is due while the previous snapshot is still running
+	// Note: The zero value skips the scheduled snapshot
+	OverrunPolicy OverrunPolicy
+
+	// ScrubInterval is how often stored snapshots are re-read and verified against their checksum
+	// Note: A value of zero disables scrubbing
+	ScrubInterval time.Duration
+
+	// Retry determines how failed snapshots are retried
+	// Note: The zero value will not retry
+	Retry RetryPolicy
+
+	// SnapshotTimeout is the maximum amount of time a single snapshot attempt may take
+	// Note: A value of zero will not apply a timeout
+	SnapshotTimeout time.Duration
+	// PurgeTimeout is the maximum amount of time a single purge may take
+	// Note: A value of zero will not apply a timeout
+	PurgeTimeout time.Duration
+
+	// SigningKey is an optional Ed25519 key used to sign each snapshot
+	// Note: Signatures are stored alongside each snapshot as a ".sig" sidecar
+	SigningKey ed25519.PrivateKey
+	// TrustedKeys are the Ed25519 public keys whose signatures are accepted on Load
+	// Note: When set, snapshots without a valid signature from a trusted key will fail to load
+	TrustedKeys []ed25519.PublicKey
+
+	// CloseTimeout is the maximum amount of time Close will wait for in-flight work
+	// Note: A value of zero will wait indefinitely
+	CloseTimeout time.Duration
+
+	// Logger is used to report errors encountered by the background loops
+	// Note: A nil value will log to stdout using the standard library logger
+	Logger Logger
+}
+
+// getSchedule will return the Schedule for the Config
+func (c *Config) getSchedule() (Schedule, error) {
+	if len(c.Schedule) == 0 {
+		return newIntervalSchedule(c.Interval), nil
+	}
+
+	return ParseSchedule(c.Schedule)
+}
+
+// getLocation will return the time.Location for the Config
+func (c *Config) getLocation() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+
+	return c.Location
+}
+
+// getKeyCodec will return the KeyCodec for the Config
+func (c *Config) getKeyCodec() KeyCodec {
+	if c.KeyCodec == nil {
+		return DefaultKeyCodec
+	}
+
+	return c.KeyCodec
+}
+
+// getRetention will return the RetentionPolicy for the Config
+func (c *Config) getRetention() RetentionPolicy {
+	if c.Retention.IsZero() {
+		// Fall back to the TTL for backwards compatibility
+		return NewTTLPolicy(c.TTL)
+	}
+
+	return c.Retention
 }
 
 // Validate will validate a Config
@@ -43,10 +147,48 @@ func (c *Config) Validate() (err error) {
 		errs.Push(ErrInvalidTruncate)
 	}
 
-	// Ensure interval value is at least one second
-	if c.Interval < Second {
+	if len(c.Schedule) > 0 {
+		// Ensure schedule expression can be parsed
+		if _, err = ParseSchedule(c.Schedule); err != nil {
+			errs.Push(err)
+		}
+	} else if c.Interval < Second {
+		// Interval value must be at least one second
 		errs.Push(ErrInvalidInterval)
 	}
 
+	// Ensure overrun policy is valid
+	if err = c.OverrunPolicy.Validate(); err != nil {
+		errs.Push(err)
+	}
+
+	// Ensure collision policy is supported by our key codec
+	if err = c.CollisionPolicy.Validate(c.getKeyCodec()); err != nil {
+		errs.Push(err)
+	}
+
+	// Ensure retry policy is valid
+	if err = c.Retry.Validate(); err != nil {
+		errs.Push(err)
+	}
+
+	// Ensure retention policy is valid
+	if err = c.Retention.Validate(); err != nil {
+		errs.Push(err)
+	}
+
+	// Ensure signing key is a complete Ed25519 private key
+	if c.SigningKey != nil && len(c.SigningKey) != ed25519.PrivateKeySize {
+		errs.Push(ErrInvalidSigningKey)
+	}
+
+	// Ensure trusted keys are valid Ed25519 public keys
+	for _, key := range c.TrustedKeys {
+		if len(key) != ed25519.PublicKeySize {
+			errs.Push(ErrInvalidPublicKey)
+			break
+		}
+	}
+
 	return errs.Err()
 }
@@ -0,0 +1,123 @@
+package snapshotter
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ContextFrontend is an optional interface for front-ends which support cancellation
+// Note: Front-ends are checked for this interface by type assertion, front-ends which
+// do not implement it will fall back to Frontend.Copy
+type ContextFrontend interface {
+	Frontend
+
+	CopyContext(ctx context.Context, w io.Writer) error
+}
+
+// ContextBackend is an optional interface for back-ends which support cancellation
+// Note: Back-ends are checked for this interface by type assertion, back-ends which
+// do not implement it will fall back to the Backend methods
+type ContextBackend interface {
+	Backend
+
+	WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) error
+	ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) error
+	DeleteContext(ctx context.Context, key string) error
+	ListContext(ctx context.Context, prefix, marker string, maxKeys int64) ([]string, error)
+	NextContext(ctx context.Context, prefix, marker string) (string, error)
+}
+
+// copyTo will copy the front-end to the provided writer
+func copyTo(ctx context.Context, fe Frontend, w io.Writer) (err error) {
+	if cfe, ok := fe.(ContextFrontend); ok {
+		return cfe.CopyContext(ctx, w)
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return fe.Copy(w)
+}
+
+// writeTo will pass a writer for the provided key to the provided function
+func writeTo(ctx context.Context, be Backend, key string, fn func(io.Writer) error) (err error) {
+	if cbe, ok := be.(ContextBackend); ok {
+		return cbe.WriteToContext(ctx, key, fn)
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return be.WriteTo(key, fn)
+}
+
+// readFrom will pass a reader for the provided key to the provided function
+func readFrom(ctx context.Context, be Backend, key string, fn func(io.Reader) error) (err error) {
+	if cbe, ok := be.(ContextBackend); ok {
+		return cbe.ReadFromContext(ctx, key, fn)
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return be.ReadFrom(key, fn)
+}
+
+// deleteKey will delete the provided key from the back-end
+func deleteKey(ctx context.Context, be Backend, key string) (err error) {
+	if cbe, ok := be.(ContextBackend); ok {
+		return cbe.DeleteContext(ctx, key)
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return be.Delete(key)
+}
+
+// list will list the back-end keys
+func list(ctx context.Context, be Backend, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	if cbe, ok := be.(ContextBackend); ok {
+		return cbe.ListContext(ctx, prefix, marker, maxKeys)
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return be.List(prefix, marker, maxKeys)
+}
+
+// next will return the next back-end key
+func next(ctx context.Context, be Backend, prefix, marker string) (key string, err error) {
+	if cbe, ok := be.(ContextBackend); ok {
+		return cbe.NextContext(ctx, prefix, marker)
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return be.Next(prefix, marker)
+}
+
+// withTimeout will return a child context with the provided timeout
+// Note: A timeout of zero will return a cancellable child context without a deadline
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,444 @@
+package snapshotter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrInvalidEncryptionKey is returned when an encryption key is not 32 bytes
+	ErrInvalidEncryptionKey = errors.Error("invalid encryption key, must be 32 bytes (raw, hex or base64 encoded)")
+	// ErrNotEncrypted is returned when reading a value which does not have an encryption header
+	ErrNotEncrypted = errors.Error("value is not encrypted, encryption header is missing")
+	// ErrDecryptionFailed is returned when a value cannot be authenticated
+	ErrDecryptionFailed = errors.Error("decryption failed, ciphertext has been tampered with or the wrong key was used")
+	// ErrTruncatedCiphertext is returned when an encrypted value ends before it's final chunk
+	ErrTruncatedCiphertext = errors.Error("decryption failed, ciphertext has been truncated")
+)
+
+const (
+	// encryptionName is the value reported within manifests for encrypted snapshots
+	encryptionName = "aes-256-gcm"
+	// encryptionVersion is the current version of the encryption header
+	// Version 1 headers do not contain a key ID and are decrypted using the key with an empty ID
+	encryptionVersion = 2
+	// encryptionChunkSize is the number of plaintext bytes sealed within each chunk
+	encryptionChunkSize = 64 * 1024
+	// encryptionKeySize is the required size of an encryption key
+	encryptionKeySize = 32
+	// gcmOverhead is the size of the authentication tag appended to each chunk
+	gcmOverhead = 16
+	// noncePrefixSize is the size of the random per-value nonce prefix, the remaining
+	// four bytes of the nonce are the chunk counter
+	noncePrefixSize = 8
+)
+
+// encryptionMagic is the leading bytes of every encrypted value
+var encryptionMagic = []byte("SSENC")
+
+// LoadKeyFile will load a 32 byte encryption key from the provided file
+// Note: The key may be stored raw, hex encoded or base64 encoded
+func LoadKeyFile(filename string) (key []byte, err error) {
+	var bs []byte
+	if bs, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	return decodeEncryptionKey(bs)
+}
+
+// LoadKeyEnv will load a 32 byte encryption key from the provided environment variable
+// Note: The key must be hex or base64 encoded
+func LoadKeyEnv(name string) (key []byte, err error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		err = fmt.Errorf("environment variable \"%s\" is not set", name)
+		return
+	}
+
+	return decodeEncryptionKey([]byte(value))
+}
+
+// decodeEncryptionKey will decode a raw, hex or base64 encoded key
+func decodeEncryptionKey(bs []byte) (key []byte, err error) {
+	if len(bs) == encryptionKeySize {
+		return bs, nil
+	}
+
+	str := strings.TrimSpace(string(bs))
+	if key, err = hex.DecodeString(str); err == nil && len(key) == encryptionKeySize {
+		return
+	}
+
+	if key, err = base64.StdEncoding.DecodeString(str); err == nil && len(key) == encryptionKeySize {
+		return
+	}
+
+	return nil, ErrInvalidEncryptionKey
+}
+
+// NewEncryptedBackend will return a back-end which encrypts values before passing them to the provided back-end
+// Note: The key is stored within a keyring using an empty key ID
+func NewEncryptedBackend(be Backend, key []byte) (ep *EncryptedBackend, err error) {
+	var kr *Keyring
+	if kr, err = NewKeyring("", key); err != nil {
+		return
+	}
+
+	return NewKeyringBackend(be, kr), nil
+}
+
+// NewKeyringBackend will return a back-end which encrypts values using the current key of the provided
+// keyring. Values are decrypted using the key whose ID is recorded within their encryption header
+func NewKeyringBackend(be Backend, kr *Keyring) *EncryptedBackend {
+	var e EncryptedBackend
+	e.be = be
+	e.kr = kr
+	return &e
+}
+
+// EncryptedBackend is a back-end decorator which encrypts on write and decrypts on read using
+// chunked AES-256-GCM. Each chunk is authenticated along with it's position and whether or not
+// it is the final chunk, so modified, re-ordered and truncated values fail to decrypt
+type EncryptedBackend struct {
+	be Backend
+	kr *Keyring
+}
+
+// WriteTo will pass an encrypting writer to the provided function
+func (e *EncryptedBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return e.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will pass an encrypting writer to the provided function
+func (e *EncryptedBackend) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	return writeTo(ctx, e.be, key, func(w io.Writer) (err error) {
+		id, aead := e.kr.getCurrent()
+
+		var ew *encryptWriter
+		if ew, err = newEncryptWriter(w, id, aead); err != nil {
+			return
+		}
+
+		if err = fn(ew); err != nil {
+			return
+		}
+
+		// Close the writer to seal the final chunk
+		return ew.Close()
+	})
+}
+
+// ReadFrom will pass a decrypting reader to the provided function
+func (e *EncryptedBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return e.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will pass a decrypting reader to the provided function
+// Note: The remainder of the value is authenticated after the function returns, so an error
+// is returned for tampered values even if the function did not read the entire value
+func (e *EncryptedBackend) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	return readFrom(ctx, e.be, key, func(r io.Reader) (err error) {
+		var dr *decryptReader
+		if dr, err = newDecryptReader(r, e.kr); err != nil {
+			return
+		}
+
+		if err = fn(dr); err != nil {
+			return
+		}
+
+		// Ensure the remainder of the value is authentic
+		_, err = io.Copy(ioutil.Discard, dr)
+		return
+	})
+}
+
+// Delete will delete a key
+func (e *EncryptedBackend) Delete(key string) (err error) {
+	return e.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will delete a key
+func (e *EncryptedBackend) DeleteContext(ctx context.Context, key string) (err error) {
+	return deleteKey(ctx, e.be, key)
+}
+
+// List will list the available keys
+func (e *EncryptedBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return e.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the available keys
+func (e *EncryptedBackend) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return list(ctx, e.be, prefix, marker, maxKeys)
+}
+
+// Next will return the next key
+func (e *EncryptedBackend) Next(prefix, marker string) (key string, err error) {
+	return e.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key
+func (e *EncryptedBackend) NextContext(ctx context.Context, prefix, marker string) (key string, err error) {
+	return next(ctx, e.be, prefix, marker)
+}
+
+// Encryption will return the encryption algorithm
+func (e *EncryptedBackend) Encryption() string {
+	return encryptionName
+}
+
+// Unwrap will return the underlying back-end
+func (e *EncryptedBackend) Unwrap() Backend {
+	return e.be
+}
+
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	if len(key) != encryptionKeySize {
+		err = ErrInvalidEncryptionKey
+		return
+	}
+
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// newEncryptWriter will write the encryption header and return a new encrypting writer
+func newEncryptWriter(w io.Writer, id string, aead cipher.AEAD) (ep *encryptWriter, err error) {
+	var e encryptWriter
+	e.w = w
+	e.aead = aead
+	e.buf = make([]byte, 0, encryptionChunkSize)
+	e.nonce = make([]byte, aead.NonceSize())
+
+	// Generate random nonce prefix for this value
+	if _, err = io.ReadFull(rand.Reader, e.nonce[:noncePrefixSize]); err != nil {
+		return
+	}
+
+	e.header = newEncryptionHeader(id, e.nonce[:noncePrefixSize])
+	if _, err = w.Write(e.header); err != nil {
+		return
+	}
+
+	ep = &e
+	return
+}
+
+// encryptWriter seals plaintext into fixed size chunks
+type encryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+
+	header []byte
+	nonce  []byte
+	buf    []byte
+
+	counter uint32
+}
+
+// Write will buffer the provided bytes, sealing each full chunk
+func (e *encryptWriter) Write(bs []byte) (n int, err error) {
+	for len(bs) > 0 {
+		if len(e.buf) == encryptionChunkSize {
+			// We have a full chunk and more data, so this chunk is not the final chunk
+			if err = e.seal(false); err != nil {
+				return
+			}
+		}
+
+		written := copy(e.buf[len(e.buf):encryptionChunkSize], bs)
+		e.buf = e.buf[:len(e.buf)+written]
+		bs = bs[written:]
+		n += written
+	}
+
+	return
+}
+
+// Close will seal the final chunk
+func (e *encryptWriter) Close() (err error) {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) (err error) {
+	binary.BigEndian.PutUint32(e.nonce[noncePrefixSize:], e.counter)
+	sealed := e.aead.Seal(nil, e.nonce, e.buf, chunkAdditionalData(e.header, final))
+	if _, err = e.w.Write(sealed); err != nil {
+		return
+	}
+
+	e.buf = e.buf[:0]
+	e.counter++
+	return
+}
+
+// newDecryptReader will read the encryption header and return a new decrypting reader
+func newDecryptReader(r io.Reader, kr *Keyring) (dp *decryptReader, err error) {
+	var d decryptReader
+	d.r = bufio.NewReaderSize(r, encryptionChunkSize+gcmOverhead)
+
+	var (
+		id          string
+		noncePrefix []byte
+	)
+
+	if d.header, id, noncePrefix, err = readEncryptionHeader(d.r); err != nil {
+		return
+	}
+
+	d.id = id
+	if d.aead, err = kr.get(id); err != nil {
+		return
+	}
+
+	d.chunk = make([]byte, encryptionChunkSize+d.aead.Overhead())
+	d.nonce = make([]byte, d.aead.NonceSize())
+	copy(d.nonce, noncePrefix)
+	dp = &d
+	return
+}
+
+// decryptReader opens and authenticates chunks as they are read
+type decryptReader struct {
+	r    *bufio.Reader
+	aead cipher.AEAD
+	// ID of the key used to encrypt the value
+	id string
+
+	header []byte
+	nonce  []byte
+	chunk  []byte
+	// Remaining plaintext of the current chunk
+	plain []byte
+
+	counter uint32
+	done    bool
+}
+
+// Read will read decrypted bytes
+func (d *decryptReader) Read(bs []byte) (n int, err error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err = d.open(); err != nil {
+			return
+		}
+	}
+
+	n = copy(bs, d.plain)
+	d.plain = d.plain[n:]
+	return
+}
+
+func (d *decryptReader) open() (err error) {
+	var n int
+	if n, err = io.ReadFull(d.r, d.chunk); err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			// Value ended before the final chunk
+			err = ErrTruncatedCiphertext
+		}
+
+		return
+	}
+
+	// The chunk is final if there is nothing after it
+	_, perr := d.r.Peek(1)
+	if perr != nil && perr != io.EOF {
+		return perr
+	}
+
+	final := perr == io.EOF
+
+	binary.BigEndian.PutUint32(d.nonce[noncePrefixSize:], d.counter)
+	if d.plain, err = d.aead.Open(d.chunk[:0], d.nonce, d.chunk[:n], chunkAdditionalData(d.header, final)); err != nil {
+		return ErrDecryptionFailed
+	}
+
+	d.counter++
+	d.done = final
+	return
+}
+
+func newEncryptionHeader(id string, noncePrefix []byte) (header []byte) {
+	header = append(header, encryptionMagic...)
+	header = append(header, encryptionVersion)
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+	header = append(header, noncePrefix...)
+	return
+}
+
+// readEncryptionHeader will read an encryption header and return it along with it's key ID and nonce prefix
+func readEncryptionHeader(r io.Reader) (header []byte, id string, noncePrefix []byte, err error) {
+	header = make([]byte, len(encryptionMagic)+1)
+	if _, err = io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, encryptionMagic) {
+		err = ErrNotEncrypted
+		return
+	}
+
+	switch version := header[len(encryptionMagic)]; version {
+	case 1:
+		// Version 1 headers do not contain a key ID
+	case 2:
+		idLen := make([]byte, 1)
+		if _, err = io.ReadFull(r, idLen); err != nil {
+			err = ErrNotEncrypted
+			return
+		}
+
+		bs := make([]byte, int(idLen[0]))
+		if _, err = io.ReadFull(r, bs); err != nil {
+			err = ErrNotEncrypted
+			return
+		}
+
+		header = append(header, idLen...)
+		header = append(header, bs...)
+		id = string(bs)
+
+	default:
+		err = fmt.Errorf("unsupported encryption version %d", version)
+		return
+	}
+
+	noncePrefix = make([]byte, noncePrefixSize)
+	if _, err = io.ReadFull(r, noncePrefix); err != nil {
+		err = ErrNotEncrypted
+		return
+	}
+
+	header = append(header, noncePrefix...)
+	return
+}
+
+// chunkAdditionalData binds each chunk to the value header and whether or not it is the final chunk
+func chunkAdditionalData(header []byte, final bool) (ad []byte) {
+	ad = append(ad, header...)
+	if final {
+		return append(ad, 1)
+	}
+
+	return append(ad, 0)
+}
@@ -0,0 +1,93 @@
+package snapshotter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestEncryptedBackend(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	be, err := NewEncryptedBackend(backends.NewFile(backendTestDir), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Use a value which spans multiple chunks
+	value := bytes.Repeat([]byte("hello world "), encryptionChunkSize/6)
+	if err = be.WriteTo("test.txt", func(w io.Writer) (err error) {
+		_, err = w.Write(value)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := path.Join(backendTestDir, "test.txt")
+
+	var stored []byte
+	if stored, err = ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(stored, []byte("hello world")) {
+		t.Fatal("expected stored value to be encrypted")
+	}
+
+	if err = be.ReadFrom("test.txt", func(r io.Reader) (err error) {
+		var bs []byte
+		if bs, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+
+		if !bytes.Equal(bs, value) {
+			t.Fatal("decrypted value does not match original value")
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	discard := func(r io.Reader) (err error) {
+		_, err = io.Copy(ioutil.Discard, r)
+		return
+	}
+
+	// Flip a bit within the ciphertext
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-20] ^= 1
+	if err = ioutil.WriteFile(filename, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = be.ReadFrom("test.txt", discard); err != ErrDecryptionFailed {
+		t.Fatalf("invalid error, expected %v and received %v", ErrDecryptionFailed, err)
+	}
+
+	// Remove the final chunk
+	truncated := stored[:len(stored)-(len(value)%encryptionChunkSize)-16]
+	if err = ioutil.WriteFile(filename, truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = be.ReadFrom("test.txt", discard); err != ErrDecryptionFailed {
+		t.Fatalf("invalid error, expected %v and received %v", ErrDecryptionFailed, err)
+	}
+
+	if _, err = NewEncryptedBackend(be, key[:16]); err != ErrInvalidEncryptionKey {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidEncryptionKey, err)
+	}
+}
@@ -1,7 +1,11 @@
 package frontends
 
 import (
+	"context"
 	"io"
+	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/boltdb/bolt"
 )
@@ -13,14 +17,163 @@ func NewBolt(db *bolt.DB) *Bolt {
 	return &b
 }
 
+// BoltRestoreOptions are the options used when restoring a bolt.DB front-end
+type BoltRestoreOptions struct {
+	// Path the restored database is written to
+	// Note: When empty, the restored database is written next to the live database
+	// with a ".restore" suffix
+	Path string
+	// Swap will replace the live database with the restored database
+	// Note: The live database is closed and re-opened, callers should access the
+	// database through Bolt.DB after a restore
+	Swap bool
+	// Options are used when re-opening the database after a swap
+	Options *bolt.Options
+}
+
 // Bolt is a front-end layer for bolt.DB
 type Bolt struct {
+	mu sync.RWMutex
 	db *bolt.DB
+
+	restoreOpts BoltRestoreOptions
+}
+
+// DB will return the underlying bolt.DB
+func (b *Bolt) DB() *bolt.DB {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.db
+}
+
+// SetRestoreOptions will set the options used when restoring
+func (b *Bolt) SetRestoreOptions(opts BoltRestoreOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.restoreOpts = opts
 }
 
 // Copy will copy to an io.Writer
 func (b *Bolt) Copy(w io.Writer) (err error) {
-	return b.db.View(func(txn *bolt.Tx) (err error) {
-		return txn.Copy(w)
+	return b.CopyContext(context.Background(), w)
+}
+
+// CopyContext will copy to an io.Writer, the copy is aborted when the context is done
+func (b *Bolt) CopyContext(ctx context.Context, w io.Writer) (err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	err = b.db.View(func(txn *bolt.Tx) (err error) {
+		return txn.Copy(newContextWriter(ctx, w))
+	})
+
+	if ctx.Err() != nil {
+		// Context was cancelled during the copy, return the context error
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// Restore will restore from an io.Reader
+func (b *Bolt) Restore(r io.Reader) (err error) {
+	return b.RestoreContext(context.Background(), r)
+}
+
+// RestoreContext will restore from an io.Reader, the restore is aborted when the context is done
+func (b *Bolt) RestoreContext(ctx context.Context, r io.Reader) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	livePath := b.db.Path()
+	target := b.restoreOpts.Path
+	if len(target) == 0 {
+		target = livePath + ".restore"
+	}
+
+	// Write the restored database to a temporary file so a failed restore never leaves a partial database
+	tmp := target + ".tmp"
+	if err = writeFile(ctx, tmp, r); err != nil {
+		os.Remove(tmp)
+		return
+	}
+
+	// Ensure the restored file is a valid database before moving it into place
+	if err = validateBolt(tmp); err != nil {
+		os.Remove(tmp)
+		return
+	}
+
+	if err = os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return
+	}
+
+	if !b.restoreOpts.Swap {
+		return
+	}
+
+	return b.swap(target, livePath)
+}
+
+// swap will replace the live database with the database at the provided path
+// Note: This is expected to be called while the write lock is held
+func (b *Bolt) swap(target, livePath string) (err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(livePath); err != nil {
+		return
+	}
+
+	if err = b.db.Close(); err != nil {
+		return
+	}
+
+	if err = os.Rename(target, livePath); err != nil {
+		// Rename failed, re-open the original database so we remain usable
+		if db, oerr := bolt.Open(livePath, info.Mode(), b.restoreOpts.Options); oerr == nil {
+			b.db = db
+		}
+
+		return
+	}
+
+	var db *bolt.DB
+	if db, err = bolt.Open(livePath, info.Mode(), b.restoreOpts.Options); err != nil {
+		return
+	}
+
+	b.db = db
+	return
+}
+
+// writeFile will write the contents of the reader to the provided filename and sync it to disk
+func writeFile(ctx context.Context, filename string, r io.Reader) (err error) {
+	if err = os.MkdirAll(filepath.Dir(filename), 0744); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(newContextWriter(ctx, f), r); err != nil {
+		return
+	}
+
+	return f.Sync()
+}
+
+// validateBolt will ensure the provided filename is a readable bolt database
+func validateBolt(filename string) (err error) {
+	var db *bolt.DB
+	if db, err = bolt.Open(filename, 0600, &bolt.Options{ReadOnly: true}); err != nil {
+		return
+	}
+	defer db.Close()
+
+	return db.View(func(txn *bolt.Tx) error {
+		return txn.ForEach(func(_ []byte, _ *bolt.Bucket) error { return nil })
 	})
 }
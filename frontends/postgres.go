@@ -1,8 +1,15 @@
 package frontends
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"strconv"
 
+	"github.com/hatchify/errors"
 	"github.com/hatchify/pgutils"
 
 	"sync/atomic"
@@ -24,7 +31,12 @@ type Postgres struct {
 
 // Copy will copy to an io.Writer
 func (p *Postgres) Copy(w io.Writer) (err error) {
-	if err = pgutils.Dump(p.cfg, w); err != nil {
+	return p.CopyContext(context.Background(), w)
+}
+
+// CopyContext will copy to an io.Writer, pg_dump is killed when the context is done
+func (p *Postgres) CopyContext(ctx context.Context, w io.Writer) (err error) {
+	if err = p.dump(ctx, w); err != nil {
 		return
 	}
 
@@ -34,3 +46,57 @@ func (p *Postgres) Copy(w io.Writer) (err error) {
 
 	return
 }
+
+// Restore will restore from an io.Reader
+func (p *Postgres) Restore(r io.Reader) (err error) {
+	return p.RestoreContext(context.Background(), r)
+}
+
+// RestoreContext will restore from an io.Reader, psql is killed when the context is done
+// Note: The snapshot is expected to be a plain SQL dump, as produced by Copy
+func (p *Postgres) RestoreContext(ctx context.Context, r io.Reader) (err error) {
+	return p.run(ctx, p.command(ctx, "psql", "-v", "ON_ERROR_STOP=1", "-q", "-d"), r, nil)
+}
+
+// dump mirrors pgutils.Dump while tying the pg_dump process to the provided context
+func (p *Postgres) dump(ctx context.Context, w io.Writer) (err error) {
+	return p.run(ctx, p.command(ctx, "pg_dump"), nil, w)
+}
+
+// command will return a command for the provided postgres binary which targets our configured database
+// Note: The database name is appended as the final argument
+func (p *Postgres) command(ctx context.Context, name string, args ...string) (cmd *exec.Cmd) {
+	args = append([]string{
+		"-h", p.cfg.Host,
+		"-p", strconv.Itoa(int(p.cfg.Port)),
+		"-U", p.cfg.User,
+	}, args...)
+
+	cmd = exec.CommandContext(ctx, name, append(args, p.cfg.Database)...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", p.cfg.Password))
+
+	if p.cfg.SSL {
+		cmd.Env = append(cmd.Env, "PGSSLMODE=allow")
+	}
+
+	return
+}
+
+// run will run the provided command, returning the contents of stderr as an error on failure
+func (p *Postgres) run(ctx context.Context, cmd *exec.Cmd, r io.Reader, w io.Writer) (err error) {
+	errBuf := bytes.NewBuffer(nil)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = errBuf
+
+	if err = cmd.Run(); err == nil {
+		return
+	}
+
+	if ctx.Err() != nil {
+		// Process was killed due to our context, return the context error
+		return ctx.Err()
+	}
+
+	return errors.Error(errBuf.String())
+}
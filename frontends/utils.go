@@ -0,0 +1,30 @@
+package frontends
+
+import (
+	"context"
+	"io"
+)
+
+// newContextWriter will return a new writer which fails once the provided context is done
+func newContextWriter(ctx context.Context, w io.Writer) *contextWriter {
+	var c contextWriter
+	c.ctx = ctx
+	c.w = w
+	return &c
+}
+
+// contextWriter is a writer which fails once it's context is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write will write to the underlying writer as long as the context is not done
+func (c *contextWriter) Write(bs []byte) (n int, err error) {
+	// Ensure our context hasn't been cancelled
+	if err = c.ctx.Err(); err != nil {
+		return
+	}
+
+	return c.w.Write(bs)
+}
@@ -11,4 +11,6 @@ require (
 	github.com/hatchify/errors v0.4.82
 	github.com/hatchify/pgutils v0.4.85
 	github.com/hatchify/scribe v0.4.87
+	github.com/klauspost/compress v1.13.6
+	github.com/prometheus/client_golang v1.11.1
 )
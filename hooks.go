@@ -0,0 +1,135 @@
+package snapshotter
+
+import (
+	"sync"
+	"time"
+)
+
+// SnapshotStartFn is called when a snapshot begins
+type SnapshotStartFn func(key string)
+
+// SnapshotCompleteFn is called when a snapshot has been successfully written
+type SnapshotCompleteFn func(key string, size int64, duration time.Duration)
+
+// SnapshotErrorFn is called when a snapshot fails
+// Note: The key is empty when the snapshot failed before it's key was chosen
+type SnapshotErrorFn func(key string, err error)
+
+// PurgeFn is called when a key has been purged
+type PurgeFn func(key string)
+
+// CorruptionFn is called when a scrub finds a corrupted snapshot
+type CorruptionFn func(key string, err error)
+
+// ScheduleFn is called when the scheduler skips, queues or coalesces a snapshot
+type ScheduleFn func(decision ScheduleDecision, requested time.Time)
+
+// hooks manages the registered event hooks
+// Note: Hooks are called after the lock has been released, so a hook may register other hooks. Hooks
+// are only ever appended, so the registered hooks can be iterated once the lock has been released
+type hooks struct {
+	mu sync.RWMutex
+
+	snapshotStart    []SnapshotStartFn
+	snapshotComplete []SnapshotCompleteFn
+	snapshotError    []SnapshotErrorFn
+	purge            []PurgeFn
+	corruption       []CorruptionFn
+	schedule         []ScheduleFn
+}
+
+func (h *hooks) addSnapshotStart(fn SnapshotStartFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshotStart = append(h.snapshotStart, fn)
+}
+
+func (h *hooks) addSnapshotComplete(fn SnapshotCompleteFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshotComplete = append(h.snapshotComplete, fn)
+}
+
+func (h *hooks) addSnapshotError(fn SnapshotErrorFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshotError = append(h.snapshotError, fn)
+}
+
+func (h *hooks) addPurge(fn PurgeFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.purge = append(h.purge, fn)
+}
+
+func (h *hooks) addCorruption(fn CorruptionFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.corruption = append(h.corruption, fn)
+}
+
+func (h *hooks) addSchedule(fn ScheduleFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.schedule = append(h.schedule, fn)
+}
+
+func (h *hooks) emitSnapshotStart(key string) {
+	h.mu.RLock()
+	fns := h.snapshotStart
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key)
+	}
+}
+
+func (h *hooks) emitSnapshotComplete(key string, size int64, duration time.Duration) {
+	h.mu.RLock()
+	fns := h.snapshotComplete
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key, size, duration)
+	}
+}
+
+func (h *hooks) emitSnapshotError(key string, err error) {
+	h.mu.RLock()
+	fns := h.snapshotError
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key, err)
+	}
+}
+
+func (h *hooks) emitPurge(key string) {
+	h.mu.RLock()
+	fns := h.purge
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key)
+	}
+}
+
+func (h *hooks) emitCorruption(key string, err error) {
+	h.mu.RLock()
+	fns := h.corruption
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key, err)
+	}
+}
+
+func (h *hooks) emitSchedule(decision ScheduleDecision, requested time.Time) {
+	h.mu.RLock()
+	fns := h.schedule
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(decision, requested)
+	}
+}
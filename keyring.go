@@ -0,0 +1,285 @@
+package snapshotter
+
+import (
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrInvalidKeyID is returned when a key ID is longer than 255 bytes
+	ErrInvalidKeyID = errors.Error("invalid key ID, cannot be longer than 255 bytes")
+	// ErrKeyNotFound is returned when a key ID does not exist within a keyring
+	ErrKeyNotFound = errors.Error("key not found within keyring")
+)
+
+// maxKeyIDSize is the maximum length of a key ID, key IDs are length prefixed by a single byte
+const maxKeyIDSize = 255
+
+// reencryptSuffix is appended to a key to stage it's re-encrypted value
+const reencryptSuffix = ".reencrypt"
+
+// NewKeyring will return a new Keyring which encrypts using the provided key
+func NewKeyring(currentID string, current []byte) (kp *Keyring, err error) {
+	var k Keyring
+	k.keys = make(map[string]cipher.AEAD)
+	if err = k.Add(currentID, current); err != nil {
+		return
+	}
+
+	k.current = currentID
+	kp = &k
+	return
+}
+
+// LoadKeyring will load a Keyring from a directory of key files, each file name is used as a key ID
+// Note: The key files may be stored raw, hex encoded or base64 encoded
+func LoadKeyring(dir, currentID string) (kp *Keyring, err error) {
+	var filenames []string
+	if filenames, err = filepath.Glob(filepath.Join(dir, "*")); err != nil {
+		return
+	}
+
+	keys := make(map[string][]byte, len(filenames))
+	for _, filename := range filenames {
+		if keys[filepath.Base(filename)], err = LoadKeyFile(filename); err != nil {
+			return nil, fmt.Errorf("error loading key \"%s\": %v", filename, err)
+		}
+	}
+
+	current, ok := keys[currentID]
+	if !ok {
+		return nil, fmt.Errorf("error loading current key \"%s\": %v", currentID, ErrKeyNotFound)
+	}
+
+	if kp, err = NewKeyring(currentID, current); err != nil {
+		return
+	}
+
+	for id, key := range keys {
+		if err = kp.Add(id, key); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Keyring holds the keys used to decrypt snapshots along with the current key used to encrypt them
+type Keyring struct {
+	mu sync.RWMutex
+
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// Add will add a decryption key to the keyring
+func (k *Keyring) Add(id string, key []byte) (err error) {
+	if len(id) > maxKeyIDSize {
+		return ErrInvalidKeyID
+	}
+
+	var aead cipher.AEAD
+	if aead, err = newAEAD(key); err != nil {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = aead
+	return
+}
+
+// SetCurrent will set the key used for encryption, the key must already exist within the keyring
+func (k *Keyring) SetCurrent(id string) (err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+
+	k.current = id
+	return
+}
+
+// Current will return the ID of the key used for encryption
+func (k *Keyring) Current() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// IDs will return the sorted IDs of all the keys within the keyring
+func (k *Keyring) IDs() (ids []string) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return
+}
+
+// get will return the key for the provided ID
+func (k *Keyring) get(id string) (aead cipher.AEAD, err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var ok bool
+	if aead, ok = k.keys[id]; !ok {
+		err = fmt.Errorf("%v: \"%s\"", ErrKeyNotFound, id)
+	}
+
+	return
+}
+
+// getCurrent will return the current key and it's ID
+func (k *Keyring) getCurrent() (id string, aead cipher.AEAD) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current, k.keys[k.current]
+}
+
+// ReencryptFn is called after each key has been visited during a re-encryption
+type ReencryptFn func(key string, rotated bool) error
+
+// Reencrypt will walk every key with the provided prefix (starting after the marker) and re-encrypt
+// the values which were not encrypted using the current key. Values which are already encrypted
+// using the current key, or which are not encrypted, are left untouched. Because of this, an
+// interrupted re-encryption can be safely resumed by running it again, optionally passing the last
+// visited key as the marker to avoid re-reading values
+// Note: Re-encrypted values are staged under a temporary key before overwriting the original value,
+// a staged value left by a failed or interrupted overwrite is moved into place when resumed
+func (e *EncryptedBackend) Reencrypt(ctx context.Context, prefix, marker string, fn ReencryptFn) (err error) {
+	currentID := e.kr.Current()
+	for {
+		var key string
+		if key, err = next(ctx, e.be, prefix, marker); err == io.EOF {
+			// We've reached the end of the key space, return
+			return nil
+		} else if err != nil {
+			return
+		}
+
+		// Staged values are only visited when their original value is missing, resume the original key
+		target := strings.TrimSuffix(key, reencryptSuffix)
+
+		var rotated bool
+		if rotated, err = e.reencrypt(ctx, target, currentID); err != nil {
+			return fmt.Errorf("error re-encrypting \"%s\": %v", target, err)
+		}
+
+		if fn != nil {
+			if err = fn(target, rotated); err != nil {
+				return
+			}
+		}
+
+		marker = key
+	}
+}
+
+// reencrypt will re-encrypt a single key if it was not encrypted using the current key
+func (e *EncryptedBackend) reencrypt(ctx context.Context, key, currentID string) (rotated bool, err error) {
+	var staged bool
+	if staged, err = e.isStaged(ctx, key); err != nil {
+		return
+	} else if staged {
+		// A previous re-encryption was interrupted while overwriting, finish moving the staged value into place
+		return true, e.promote(ctx, key)
+	}
+
+	if err = readFrom(ctx, e.be, key, func(r io.Reader) (err error) {
+		var dr *decryptReader
+		if dr, err = newDecryptReader(r, e.kr); err == ErrNotEncrypted {
+			// Value is not encrypted, skip
+			return nil
+		} else if err != nil {
+			return
+		}
+
+		if dr.id == currentID {
+			// Value is already encrypted using the current key, skip
+			return
+		}
+
+		// Stream the re-encrypted value to it's staged key, the original value is not touched
+		// until the staged value is complete. The decrypted value never touches the disk
+		if err = e.WriteToContext(ctx, key+reencryptSuffix, func(w io.Writer) (err error) {
+			_, err = io.Copy(w, dr)
+			return
+		}); err != nil {
+			return
+		}
+
+		rotated = true
+		return
+	}); err != nil || !rotated {
+		return
+	}
+
+	err = e.promote(ctx, key)
+	return
+}
+
+// isStaged will return whether or not a complete staged value exists for the provided key
+// Note: An incomplete staged value is left when staging was interrupted, the original value
+// is still intact in that case so the staged value is removed
+func (e *EncryptedBackend) isStaged(ctx context.Context, key string) (staged bool, err error) {
+	stagedKey := key + reencryptSuffix
+
+	var nextKey string
+	if nextKey, err = next(ctx, e.be, stagedKey, ""); err == io.EOF || (err == nil && nextKey != stagedKey) {
+		// Staged value does not exist
+		return false, nil
+	} else if err != nil {
+		return
+	}
+
+	// Ensure the staged value decrypts in full
+	err = readFrom(ctx, e.be, stagedKey, func(r io.Reader) (err error) {
+		var dr *decryptReader
+		if dr, err = newDecryptReader(r, e.kr); err != nil {
+			return
+		}
+
+		_, err = io.Copy(ioutil.Discard, dr)
+		return
+	})
+
+	switch err {
+	case nil:
+		return true, nil
+	case ErrNotEncrypted, ErrDecryptionFailed, ErrTruncatedCiphertext, io.EOF, io.ErrUnexpectedEOF:
+		// Staged value is incomplete, remove it
+		return false, deleteKey(ctx, e.be, stagedKey)
+
+	default:
+		return
+	}
+}
+
+// promote will copy the staged value of the provided key over the original value and remove the staged value
+// Note: The staged value is only removed once the copy has succeeded, so a failed copy can be resumed
+func (e *EncryptedBackend) promote(ctx context.Context, key string) (err error) {
+	stagedKey := key + reencryptSuffix
+	if err = readFrom(ctx, e.be, stagedKey, func(r io.Reader) error {
+		// The staged value is already encrypted, copy it as-is
+		return writeTo(ctx, e.be, key, func(w io.Writer) (err error) {
+			_, err = io.Copy(w, r)
+			return
+		})
+	}); err != nil {
+		return
+	}
+
+	return deleteKey(ctx, e.be, stagedKey)
+}
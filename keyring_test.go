@@ -0,0 +1,192 @@
+package snapshotter
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+)
+
+func TestKeyring_Reencrypt(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+
+	oldKey := newTestKey(t)
+	newKey := newTestKey(t)
+
+	kr, err := NewKeyring("old", oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	be := NewKeyringBackend(backends.NewFile(backendTestDir), kr)
+	for _, key := range []string{"test.1.txt", "test.2.txt"} {
+		if err = be.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rotate to our new key
+	if err = kr.Add("new", newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = kr.SetCurrent("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values encrypted with the old key can still be read
+	if err = be.ReadFrom("test.1.txt", confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+
+	var rotated []string
+	if err = be.Reencrypt(context.Background(), "test", "", func(key string, ok bool) (err error) {
+		if ok {
+			rotated = append(rotated, key)
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rotated) != 2 {
+		t.Fatalf("invalid rotated keys, expected %d and received %v", 2, rotated)
+	}
+
+	// Running again should not rotate anything
+	rotated = rotated[:0]
+	if err = be.Reencrypt(context.Background(), "test", "", func(key string, ok bool) (err error) {
+		if ok {
+			rotated = append(rotated, key)
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rotated) != 0 {
+		t.Fatalf("invalid rotated keys, expected none and received %v", rotated)
+	}
+
+	// Values can be read using a keyring which only contains the new key
+	var nkr *Keyring
+	if nkr, err = NewKeyring("new", newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	nbe := NewKeyringBackend(backends.NewFile(backendTestDir), nkr)
+	if err = nbe.ReadFrom("test.2.txt", confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyring_ReencryptInterrupted(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+
+	kr, err := NewKeyring("old", newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fbe := backends.NewFile(backendTestDir)
+	failing := &testFailingWriteBackend{Backend: fbe, key: "test.1.txt"}
+	be := NewKeyringBackend(failing, kr)
+	if err = be.WriteTo("test.1.txt", func(w io.Writer) (err error) {
+		_, err = w.Write([]byte("hello world"))
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = kr.Add("new", newTestKey(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = kr.SetCurrent("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a re-encryption which was interrupted while staging, the original value is still intact
+	if err = fbe.WriteTo("test.1.txt"+reencryptSuffix, func(w io.Writer) (err error) {
+		_, err = w.Write(encryptionMagic)
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail the overwrite of the original value partway through
+	failing.enabled.Set(true)
+	if err = be.Reencrypt(context.Background(), "test", "", nil); err == nil {
+		t.Fatal("expected an error re-encrypting and received nil")
+	}
+
+	// Resume the re-encryption, the staged value is moved into place
+	failing.enabled.Set(false)
+	var rotated []string
+	if err = be.Reencrypt(context.Background(), "test", "", func(key string, ok bool) (err error) {
+		if ok {
+			rotated = append(rotated, key)
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rotated) != 1 || rotated[0] != "test.1.txt" {
+		t.Fatalf("invalid rotated keys, expected %v and received %v", []string{"test.1.txt"}, rotated)
+	}
+
+	if err = be.ReadFrom("test.1.txt", confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	if keys, err = fbe.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 {
+		t.Fatalf("invalid keys, expected %v and received %v", []string{"test.1.txt"}, keys)
+	}
+}
+
+// testFailingWriteBackend is a back-end which fails writes to a key partway through while enabled
+type testFailingWriteBackend struct {
+	Backend
+
+	key     string
+	enabled atoms.Bool
+}
+
+// WriteTo will pass a writer to the provided function
+func (f *testFailingWriteBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	if key != f.key || !f.enabled.Get() {
+		return f.Backend.WriteTo(key, fn)
+	}
+
+	return f.Backend.WriteTo(key, func(w io.Writer) (err error) {
+		w.Write([]byte("hello"))
+		return errTestTransient
+	})
+}
+
+func newTestKey(t *testing.T) (key []byte) {
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
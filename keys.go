@@ -0,0 +1,277 @@
+package snapshotter
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// keyVersion is the version token embedded within keys produced by KeyFormat
+	keyVersion = "v1"
+	// keySeparator separates the components of a key
+	keySeparator = "."
+	// latestToken identifies the key which holds the latest snapshot key
+	latestToken = "latest"
+	// latestExtension is the extension of the key which holds the latest snapshot key
+	latestExtension = "txt"
+	// sequenceSeparator separates the timestamp of a key from it's sequence number
+	sequenceSeparator = "_"
+	// sequenceWidth is the zero-padded width of a sequence number, this keeps sequenced keys in order
+	sequenceWidth = 6
+	// unixTimestampPrefix is prepended to unix timestamps. Keys made by older versions have bare unix
+	// timestamps, so the prefix distinguishes our keys from an older key whose name ends with the
+	// version token (e.g. "orders.v1.1792245600.sql" is an older key of the name "orders.v1")
+	unixTimestampPrefix = "u"
+	// iso8601Layout is the ISO 8601 basic format, unlike RFC 3339 it does not contain colons
+	// so keys remain valid file names on every platform
+	iso8601Layout = "20060102T150405Z"
+)
+
+// DefaultKeyCodec is the KeyCodec used when Config.KeyCodec is not set
+var DefaultKeyCodec KeyCodec = KeyFormat{}
+
+// KeyCodec encodes and decodes the keys snapshots are stored under
+type KeyCodec interface {
+	// Encode will return the key for a snapshot of the provided name, extension and time
+	Encode(name, ext string, t time.Time) (key string)
+	// Decode will parse a key produced by Encode
+	// Note: ErrIsLatestKey is returned for the key produced by Latest
+	Decode(key string) (name, ext string, t time.Time, err error)
+	// Prefix will return a prefix which matches every key of the provided name, and no other name
+	Prefix(name string) (prefix string)
+	// Marker will return a list marker which sorts directly before every key of the provided
+	// name with a time at or after the provided time
+	Marker(name string, t time.Time) (marker string)
+	// Latest will return the key which holds the latest snapshot key for the provided name
+	Latest(name string) (key string)
+}
+
+// SequenceCodec is an optional interface for key codecs which support multiple snapshots
+// within the same truncated time, as required by CollisionSequence
+type SequenceCodec interface {
+	KeyCodec
+
+	// EncodeSequence will return the key for a snapshot with the provided sequence number
+	// Note: A sequence number of zero must return the same key as Encode
+	EncodeSequence(name, ext string, t time.Time, seq int) (key string)
+	// DecodeSequence will parse a key produced by EncodeSequence
+	DecodeSequence(key string) (name, ext string, t time.Time, seq int, err error)
+}
+
+// legacyKeyCodec is implemented by key codecs which decode keys made by older versions
+type legacyKeyCodec interface {
+	// legacyPrefix will return the prefix of keys made by older versions for the provided name
+	legacyPrefix(name string) (prefix string, ok bool)
+}
+
+// TimestampFormat is the format of the timestamp within a key
+type TimestampFormat uint8
+
+const (
+	// TimestampUnix will encode timestamps as prefixed unix seconds (e.g. u1792245600)
+	TimestampUnix TimestampFormat = iota
+	// TimestampISO8601 will encode timestamps as UTC ISO 8601 basic format (e.g. 20261017T140000Z)
+	TimestampISO8601
+)
+
+// KeyLayout is the directory layout keys are stored under
+type KeyLayout uint8
+
+const (
+	// LayoutFlat will store keys without directories (e.g. name.v1.u1792245600.sql)
+	LayoutFlat KeyLayout = iota
+	// LayoutYear will store keys within a directory per year (e.g. name/2026/...)
+	LayoutYear
+	// LayoutMonth will store keys within a directory per month (e.g. name/2026/10/...)
+	LayoutMonth
+	// LayoutDay will store keys within a directory per day (e.g. name/2026/10/17/...)
+	LayoutDay
+)
+
+// KeyFormat is the default KeyCodec. Keys are versioned and the name and extension are escaped,
+// so names and extensions may contain dots (e.g. "orders.v2" and "tar.gz")
+// Note: Keys made by older versions (name.unix.ext) are decoded as long as the name and extension
+// do not contain dots, the migrate command will rename them to the current format
+type KeyFormat struct {
+	Timestamp TimestampFormat
+	Layout    KeyLayout
+}
+
+// Encode will return the key for a snapshot of the provided name, extension and time
+func (k KeyFormat) Encode(name, ext string, t time.Time) (key string) {
+	return k.EncodeSequence(name, ext, t, 0)
+}
+
+// EncodeSequence will return the key for a snapshot with the provided sequence number
+// Note: Sequence numbers are appended to the timestamp (e.g. name.v1.u1792245600_000001.sql)
+func (k KeyFormat) EncodeSequence(name, ext string, t time.Time, seq int) (key string) {
+	key = k.Marker(name, t)
+	if seq > 0 {
+		key += fmt.Sprintf("%s%0*d", sequenceSeparator, sequenceWidth, seq)
+	}
+
+	return key + keySeparator + escapeKeyComponent(ext)
+}
+
+// Decode will parse a key produced by Encode
+func (k KeyFormat) Decode(key string) (name, ext string, t time.Time, err error) {
+	name, ext, t, _, err = k.DecodeSequence(key)
+	return
+}
+
+// DecodeSequence will parse a key produced by EncodeSequence
+func (k KeyFormat) DecodeSequence(key string) (name, ext string, t time.Time, seq int, err error) {
+	spl := strings.Split(path.Base(key), keySeparator)
+	switch {
+	case len(spl) == 3 && spl[1] == latestToken:
+		err = ErrIsLatestKey
+		return
+	case len(spl) == 3:
+		// Key was made by an older version
+		var unixTS int64
+		if unixTS, err = strconv.ParseInt(spl[1], 10, 64); err != nil {
+			err = ErrInvalidKey
+			return
+		}
+
+		return spl[0], spl[2], time.Unix(unixTS, 0), 0, nil
+	case len(spl) == 4 && spl[1] == keyVersion:
+	default:
+		err = ErrInvalidKey
+		return
+	}
+
+	// Older keys whose name contains dots may have the same number of components, only keys with
+	// canonically escaped components and a prefixed timestamp are treated as the current format
+	if name, err = unescapeKeyComponent(spl[0]); err != nil {
+		return
+	}
+
+	if ext, err = unescapeKeyComponent(spl[3]); err != nil {
+		return
+	}
+
+	timestamp := spl[2]
+	if i := strings.Index(timestamp, sequenceSeparator); i > -1 {
+		if seq, err = strconv.Atoi(timestamp[i+1:]); err != nil || seq < 1 {
+			err = ErrInvalidKey
+			return
+		}
+
+		timestamp = timestamp[:i]
+	}
+
+	if t, err = parseKeyTimestamp(timestamp); err != nil {
+		err = ErrInvalidKey
+		return
+	}
+
+	return
+}
+
+// legacyPrefix will return the prefix of keys made by older versions (name.unix.ext) for the provided name
+// Note: Older keys are not escaped and are always stored without directories. Older keys of names
+// containing dots or slashes cannot be decoded, so these names have no prefix
+func (k KeyFormat) legacyPrefix(name string) (prefix string, ok bool) {
+	if strings.ContainsAny(name, keySeparator+"/") {
+		return "", false
+	}
+
+	return name + keySeparator, true
+}
+
+// Prefix will return a prefix which matches every key of the provided name, and no other name
+func (k KeyFormat) Prefix(name string) (prefix string) {
+	if k.Layout == LayoutFlat {
+		return escapeKeyComponent(name) + keySeparator
+	}
+
+	return escapeKeyComponent(name) + "/"
+}
+
+// Marker will return a list marker which sorts directly before every key of the provided
+// name with a time at or after the provided time
+func (k KeyFormat) Marker(name string, t time.Time) (marker string) {
+	escaped := escapeKeyComponent(name)
+	return k.directory(name, t) + escaped + keySeparator + keyVersion + keySeparator + k.timestamp(t)
+}
+
+// Latest will return the key which holds the latest snapshot key for the provided name
+func (k KeyFormat) Latest(name string) (key string) {
+	escaped := escapeKeyComponent(name)
+	key = escaped + keySeparator + latestToken + keySeparator + latestExtension
+	if k.Layout == LayoutFlat {
+		return
+	}
+
+	return escaped + "/" + key
+}
+
+// directory will return the directory of the key for the provided name and time
+func (k KeyFormat) directory(name string, t time.Time) (dir string) {
+	t = t.UTC()
+	switch k.Layout {
+	case LayoutYear:
+		return fmt.Sprintf("%s/%04d/", escapeKeyComponent(name), t.Year())
+	case LayoutMonth:
+		return fmt.Sprintf("%s/%04d/%02d/", escapeKeyComponent(name), t.Year(), t.Month())
+	case LayoutDay:
+		return fmt.Sprintf("%s/%04d/%02d/%02d/", escapeKeyComponent(name), t.Year(), t.Month(), t.Day())
+
+	default:
+		return ""
+	}
+}
+
+// timestamp will return the encoded timestamp for the provided time
+func (k KeyFormat) timestamp(t time.Time) string {
+	if k.Timestamp == TimestampISO8601 {
+		return t.UTC().Format(iso8601Layout)
+	}
+
+	return unixTimestampPrefix + strconv.FormatInt(t.Unix(), 10)
+}
+
+// parseKeyTimestamp will parse a timestamp in either of the supported formats
+// Note: Bare unix timestamps are not accepted, these only exist within keys made by older versions
+func parseKeyTimestamp(str string) (t time.Time, err error) {
+	if strings.HasPrefix(str, unixTimestampPrefix) {
+		var unixTS int64
+		if unixTS, err = strconv.ParseInt(str[len(unixTimestampPrefix):], 10, 64); err != nil {
+			return
+		}
+
+		return time.Unix(unixTS, 0), nil
+	}
+
+	return time.Parse(iso8601Layout, str)
+}
+
+// unescapeKeyComponent will decode a component encoded by escapeKeyComponent
+// Note: Components which are not canonically encoded were not produced by escapeKeyComponent
+func unescapeKeyComponent(str string) (unescaped string, err error) {
+	if unescaped, err = url.PathUnescape(str); err != nil || escapeKeyComponent(unescaped) != str {
+		return "", ErrInvalidKey
+	}
+
+	return
+}
+
+// escapeKeyComponent will percent-encode the characters which have meaning within a key
+func escapeKeyComponent(str string) string {
+	var sb strings.Builder
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; c {
+		case '%', '.', '/':
+			fmt.Fprintf(&sb, "%%%02X", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,241 @@
+package snapshotter
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestKeyFormat(t *testing.T) {
+	ts := time.Date(2026, time.October, 17, 14, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		codec    KeyFormat
+		name     string
+		ext      string
+		expected string
+	}{
+		{codec: KeyFormat{}, name: "test", ext: "txt", expected: "test.v1.u1792245600.txt"},
+		{codec: KeyFormat{}, name: "orders.v2", ext: "tar.gz", expected: "orders%2Ev2.v1.u1792245600.tar%2Egz"},
+		{codec: KeyFormat{Timestamp: TimestampISO8601}, name: "test", ext: "txt", expected: "test.v1.20261017T140000Z.txt"},
+		{codec: KeyFormat{Layout: LayoutYear}, name: "test", ext: "txt", expected: "test/2026/test.v1.u1792245600.txt"},
+		{codec: KeyFormat{Layout: LayoutMonth}, name: "test", ext: "txt", expected: "test/2026/10/test.v1.u1792245600.txt"},
+		{codec: KeyFormat{Layout: LayoutDay}, name: "a/b", ext: "txt", expected: "a%2Fb/2026/10/17/a%2Fb.v1.u1792245600.txt"},
+	}
+
+	for _, tc := range tcs {
+		key := tc.codec.Encode(tc.name, tc.ext, ts)
+		if key != tc.expected {
+			t.Fatalf("invalid key, expected \"%s\" and received \"%s\"", tc.expected, key)
+		}
+
+		if !strings.HasPrefix(key, tc.codec.Prefix(tc.name)) {
+			t.Fatalf("key \"%s\" does not begin with prefix \"%s\"", key, tc.codec.Prefix(tc.name))
+		}
+
+		if marker := tc.codec.Marker(tc.name, ts); key <= marker {
+			t.Fatalf("key \"%s\" does not follow marker \"%s\"", key, marker)
+		}
+
+		name, ext, decoded, err := tc.codec.Decode(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name != tc.name || ext != tc.ext || !decoded.Equal(ts) {
+			t.Fatalf("invalid decoded values, expected (%s, %s, %v) and received (%s, %s, %v)", tc.name, tc.ext, ts, name, ext, decoded)
+		}
+
+		if _, _, _, err = tc.codec.Decode(tc.codec.Latest(tc.name)); err != ErrIsLatestKey {
+			t.Fatalf("invalid error, expected %v and received %v", ErrIsLatestKey, err)
+		}
+	}
+
+	// Ensure keys made by older versions can be decoded
+	name, ext, decoded, err := DefaultKeyCodec.Decode("test.1792245600.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "test" || ext != "txt" || !decoded.Equal(ts) {
+		t.Fatalf("invalid decoded values, expected (test, txt, %v) and received (%s, %s, %v)", ts, name, ext, decoded)
+	}
+
+	// Ensure older keys of a name ending with the version token are not mistaken for the current format
+	for _, key := range []string{"orders.v1.1792245600.sql", "orders.v1.u1792245600.s%71l", "orders.v1.2026-10-17T14:00:00Z.sql"} {
+		if _, _, _, err = DefaultKeyCodec.Decode(key); err != ErrInvalidKey {
+			t.Fatalf("invalid error decoding \"%s\", expected %v and received %v", key, ErrInvalidKey, err)
+		}
+	}
+
+	// Ensure prefixes do not overlap between names sharing a common beginning
+	if key := DefaultKeyCodec.Encode("database", "txt", ts); strings.HasPrefix(key, DefaultKeyCodec.Prefix("data")) {
+		t.Fatalf("key \"%s\" should not match prefix \"%s\"", key, DefaultKeyCodec.Prefix("data"))
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	ctx := context.Background()
+
+	write := func(key, value string) {
+		if err := be.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte(value))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Write keys made by older versions, including a name and extension containing dots
+	write("orders.v2.1792245600.tar.gz", "hello world")
+	write("orders.v2.1792245600.tar.gz"+manifestSuffix, "{}")
+	write("orders.v2.1792249200.tar.gz", "hello world")
+	write("orders.v2.latest.txt", "orders.v2.1792249200.tar.gz")
+	// Write a key which does not belong to us
+	write("orders.v3.1792245600.tar.gz", "hello world")
+
+	codec := KeyFormat{Timestamp: TimestampISO8601, Layout: LayoutDay}
+
+	var renamed int
+	if err := MigrateKeys(ctx, be, "orders.v2", "tar.gz", codec, nil, func(oldKey, newKey string) error {
+		renamed++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if renamed != 2 {
+		t.Fatalf("invalid number of renamed keys, expected %d and received %d", 2, renamed)
+	}
+
+	s := &Snapshotter{be: be, cfg: NewConfig("orders.v2", "tar.gz"), codec: codec}
+	entries, _, err := s.listEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("invalid number of entries, expected %d and received %d", 2, len(entries))
+	}
+
+	var latest string
+	if latest, err = s.getLatest(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := codec.Encode("orders.v2", "tar.gz", time.Unix(1792249200, 0)); latest != expected {
+		t.Fatalf("invalid latest key, expected \"%s\" and received \"%s\"", expected, latest)
+	}
+
+	var m Manifest
+	manifestKey := codec.Encode("orders.v2", "tar.gz", time.Unix(1792245600, 0))
+	if m, err = s.getManifest(ctx, manifestKey); err != nil {
+		t.Fatalf("expected manifest to be moved: %v", err)
+	}
+
+	if m.Key != manifestKey {
+		t.Fatalf("invalid manifest key, expected \"%s\" and received \"%s\"", manifestKey, m.Key)
+	}
+
+	var keys []string
+	if keys, err = be.List("orders", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, "orders.v2.") {
+			t.Fatalf("key \"%s\" should have been migrated", key)
+		}
+	}
+
+	// Running the migration again should be a no-op
+	renamed = 0
+	if err = MigrateKeys(ctx, be, "orders.v2", "tar.gz", codec, nil, func(oldKey, newKey string) error {
+		renamed++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if renamed != 0 {
+		t.Fatalf("invalid number of renamed keys, expected %d and received %d", 0, renamed)
+	}
+}
+
+func TestMigrateKeys_Signed(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	ctx := context.Background()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+	cfg.SigningKey = private
+
+	var s *Snapshotter
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var oldKey string
+	if oldKey, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	codec := KeyFormat{Timestamp: TimestampISO8601}
+
+	// Signed snapshots cannot be migrated without a signing key
+	if err = MigrateKeys(ctx, be, "test", "txt", codec, nil, nil); err != ErrSignedMigration {
+		t.Fatalf("invalid error, expected %v and received %v", ErrSignedMigration, err)
+	}
+
+	if err = VerifySnapshot(ctx, be, oldKey, []ed25519.PublicKey{public}); err != nil {
+		t.Fatalf("expected the snapshot to be left in place: %v", err)
+	}
+
+	var newKey string
+	if err = MigrateKeys(ctx, be, "test", "txt", codec, private, func(_, key string) error {
+		newKey = key
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The migrated snapshot is re-signed for it's new key
+	if err = VerifySnapshot(ctx, be, newKey, []ed25519.PublicKey{public}); err != nil {
+		t.Fatal(err)
+	}
+
+	var exists bool
+	if exists, err = keyExists(ctx, be, oldKey+signatureSuffix); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Fatalf("expected the signature of \"%s\" to be removed", oldKey)
+	}
+}
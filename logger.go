@@ -0,0 +1,105 @@
+package snapshotter
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hatchify/scribe"
+)
+
+// defaultLogger is used when a Config does not provide a Logger
+var defaultLogger = NewStdLogger(log.New(os.Stdout, "snapshotter: ", log.LstdFlags))
+
+// Fields are the structured values associated with a log entry
+type Fields map[string]interface{}
+
+// String will return the fields as sorted key=value pairs
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+
+	// Sort keys so our output is deterministic
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, fmt.Sprint(f[key])))
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// Logger is the interface used to report snapshotter events
+type Logger interface {
+	Info(msg string, fields Fields)
+	Warning(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+// NewScribeLogger will return a Logger which writes to the provided scribe.Scribe
+func NewScribeLogger(out *scribe.Scribe) Logger {
+	var s scribeLogger
+	s.out = out
+	return &s
+}
+
+// scribeLogger adapts a scribe.Scribe to the Logger interface
+type scribeLogger struct {
+	out *scribe.Scribe
+}
+
+// Info will write an info entry
+func (s *scribeLogger) Info(msg string, fields Fields) {
+	s.out.NotificationWithData(msg, fields)
+}
+
+// Warning will write a warning entry
+func (s *scribeLogger) Warning(msg string, fields Fields) {
+	s.out.WarningWithData(msg, fields)
+}
+
+// Error will write an error entry
+func (s *scribeLogger) Error(msg string, fields Fields) {
+	s.out.ErrorWithData(msg, fields)
+}
+
+// NewStdLogger will return a Logger which writes to the provided log.Logger
+func NewStdLogger(out *log.Logger) Logger {
+	var s stdLogger
+	s.out = out
+	return &s
+}
+
+// stdLogger adapts a standard library log.Logger to the Logger interface
+type stdLogger struct {
+	out *log.Logger
+}
+
+// Info will write an info entry
+func (s *stdLogger) Info(msg string, fields Fields) {
+	s.write("INFO", msg, fields)
+}
+
+// Warning will write a warning entry
+func (s *stdLogger) Warning(msg string, fields Fields) {
+	s.write("WARNING", msg, fields)
+}
+
+// Error will write an error entry
+func (s *stdLogger) Error(msg string, fields Fields) {
+	s.write("ERROR", msg, fields)
+}
+
+func (s *stdLogger) write(level, msg string, fields Fields) {
+	if len(fields) == 0 {
+		s.out.Printf("level=%s msg=%q", level, msg)
+		return
+	}
+
+	s.out.Printf("level=%s msg=%q %s", level, msg, fields.String())
+}
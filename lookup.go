@@ -0,0 +1,212 @@
+package snapshotter
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrSnapshotNotFound is returned when no snapshot exists for the requested time
+const ErrSnapshotNotFound = errors.Error("no snapshot found for the requested time")
+
+// lookupWindow is the initial window searched by KeyAt, the window grows until a snapshot is found
+const lookupWindow = Hour
+
+// KeyAt will return the key of the most recent snapshot taken at or before the provided time
+func (s *Snapshotter) KeyAt(t time.Time) (key string, err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		err = errors.ErrIsClosed
+		return
+	}
+
+	return s.keyAt(s.work, t)
+}
+
+// KeysBetween will return the keys of the snapshots taken between the provided times (inclusive), oldest first
+func (s *Snapshotter) KeysBetween(from, to time.Time) (keys []string, err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		err = errors.ErrIsClosed
+		return
+	}
+
+	var entries []snapshotEntry
+	if entries, err = s.entriesBetween(s.work, from, to); err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		keys = append(keys, entry.key)
+	}
+
+	return
+}
+
+// keyAt searches a growing window preceding the provided time so that only the keys
+// near the requested time are listed, rather than the entire key space
+func (s *Snapshotter) keyAt(ctx context.Context, t time.Time) (key string, err error) {
+	for window := lookupWindow; ; window *= 4 {
+		from := t.Add(-window)
+		if from.Unix() <= 0 {
+			// Window covers the entire key space, search from the beginning
+			from = time.Time{}
+		}
+
+		var entries []snapshotEntry
+		if entries, err = s.entriesBetween(ctx, from, t); err != nil {
+			return
+		}
+
+		if len(entries) > 0 {
+			// Entries are sorted oldest first, return the most recent
+			key = entries[len(entries)-1].key
+			return
+		}
+
+		if from.IsZero() {
+			// Entire key space has been searched, return
+			err = ErrSnapshotNotFound
+			return
+		}
+	}
+}
+
+// entriesBetween will return the snapshot entries taken between the provided times (inclusive), oldest first
+// Note: Keys are timestamped with the start of their truncation window, so a key may hold a snapshot
+// taken well after it's timestamp. Entries are compared (and returned) using the time they were taken
+func (s *Snapshotter) entriesBetween(ctx context.Context, from, to time.Time) (entries []snapshotEntry, err error) {
+	start := from
+	if !from.IsZero() {
+		// Snapshots taken after the start time may be stored under the key of it's truncation window
+		start = getTruncated(from.In(s.cfg.getLocation()), s.cfg.Truncate)
+	}
+
+	var keyed []snapshotEntry
+	if keyed, err = s.keyedBetween(ctx, start, to); err != nil {
+		return
+	}
+
+	for _, entry := range keyed {
+		if entry.time, err = s.takenAt(ctx, entry); err != nil {
+			return
+		}
+
+		if entry.time.Before(from) || entry.time.After(to) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].before(entries[j])
+	})
+
+	return
+}
+
+// takenAt will return the time the snapshot of the provided entry was taken, which is the end time within
+// it's manifest. Snapshots without a manifest (made by older versions) may have been taken at any time
+// within their truncation window, so these are treated as taken at the end of the window
+func (s *Snapshotter) takenAt(ctx context.Context, entry snapshotEntry) (t time.Time, err error) {
+	var m Manifest
+	if m, err = s.lookupManifest(ctx, entry.key); err == errNoManifest || (err == nil && m.End.IsZero()) {
+		return getTruncatedEnd(entry.time.In(s.cfg.getLocation()), s.cfg.Truncate), nil
+	} else if err != nil {
+		return
+	}
+
+	return m.End, nil
+}
+
+// keyedBetween will return the snapshot entries whose key times are between the provided times (inclusive)
+// Note: Listing begins at a marker derived from the start time, keys are timestamped so the back-end
+// can skip everything which precedes it. Keys made by older versions sort before the marker of the
+// current format, so these are listed separately
+func (s *Snapshotter) keyedBetween(ctx context.Context, from, to time.Time) (entries []snapshotEntry, err error) {
+	seen := make(map[string]bool)
+	if lc, ok := s.codec.(legacyKeyCodec); ok {
+		if prefix, ok := lc.legacyPrefix(s.cfg.Name); ok {
+			marker := prefix
+			if !from.IsZero() {
+				// Older keys for the start time follow this marker
+				marker += strconv.FormatInt(from.Unix(), 10)
+			}
+
+			if entries, err = s.listBetween(ctx, entries, prefix, marker, from, to, true, seen); err != nil {
+				return
+			}
+		}
+	}
+
+	prefix := s.codec.Prefix(s.cfg.Name)
+	marker := prefix
+	if !from.IsZero() {
+		// Keys for the start time follow this marker
+		marker = s.codec.Marker(s.cfg.Name, from)
+	}
+
+	entries, err = s.listBetween(ctx, entries, prefix, marker, from, to, false, seen)
+	return
+}
+
+// listBetween will append the entries between the provided times (inclusive) which match the provided prefix
+// and follow the provided marker. Keys within the seen map are skipped, appended keys are added to it
+// Note: When legacy is set, listing ends at the first key which was not made by an older version
+func (s *Snapshotter) listBetween(ctx context.Context, in []snapshotEntry, prefix, marker string, from, to time.Time, legacy bool, seen map[string]bool) (entries []snapshotEntry, err error) {
+	entries = in
+	for {
+		var keys []string
+		if keys, err = list(ctx, s.be, prefix, marker, purgePageSize); err != nil {
+			return
+		}
+
+		var done bool
+		for _, key := range keys {
+			if legacy && !isLegacyTimestamp(key[len(prefix):]) {
+				// We've passed the keys made by older versions
+				done = true
+				break
+			}
+
+			if isSidecar(key) || seen[key] {
+				continue
+			}
+
+			name, _, ts, perr := s.codec.Decode(key)
+			if perr != nil || name != s.cfg.Name {
+				// Key does not belong to us, continue
+				continue
+			}
+
+			switch {
+			case ts.After(to):
+				// We've passed the end of our range
+				done = true
+			case ts.Before(from):
+			default:
+				seen[key] = true
+				entries = append(entries, snapshotEntry{key: key, time: ts})
+			}
+		}
+
+		if done || len(keys) < purgePageSize {
+			return
+		}
+
+		// Set marker as the last key we've seen
+		marker = keys[len(keys)-1]
+	}
+}
+
+// isLegacyTimestamp will return whether or not the provided remainder of a key
+// (following the name) begins with the unix timestamp of an older key
+func isLegacyTimestamp(remainder string) bool {
+	return len(remainder) > 0 && remainder[0] >= '0' && remainder[0] <= '9'
+}
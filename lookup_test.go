@@ -0,0 +1,203 @@
+package snapshotter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestSnapshotter_KeyAt(t *testing.T) {
+	codecs := []KeyCodec{
+		KeyFormat{},
+		KeyFormat{Timestamp: TimestampISO8601, Layout: LayoutDay},
+	}
+
+	for _, codec := range codecs {
+		testKeyAt(t, codec)
+	}
+}
+
+func testKeyAt(t *testing.T, codec KeyCodec) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	write := func(key string) {
+		if err := be.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Initialize a Snapshotter without background loops
+	s := &Snapshotter{be: be, cfg: NewConfig("test", "txt"), codec: codec}
+	ctx := context.Background()
+
+	// snapshot will write a snapshot (and it's manifest) taken at the start of it's truncation window
+	snapshot := func(ts time.Time) {
+		key := codec.Encode("test", "txt", ts)
+		write(key)
+		if err := s.setManifest(ctx, Manifest{Key: key, Start: ts, End: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Write a snapshot every hour for the past day, plus one from a month ago
+	now := time.Now().Truncate(Hour)
+	for i := 0; i < 24; i++ {
+		snapshot(now.Add(-Hour * time.Duration(i)))
+	}
+
+	old := now.Add(-Month)
+	snapshot(old)
+	// Write a key for a name which begins with our name
+	write(codec.Encode("testing", "txt", now))
+	// Write a key made by an older version
+	legacy := now.Add(-Hour * 48)
+	legacyKey := fmt.Sprintf("test.%d.txt", legacy.Unix())
+	write(legacyKey)
+
+	tcs := []struct {
+		t        time.Time
+		expected time.Time
+		err      error
+	}{
+		{t: now, expected: now},
+		{t: now.Add(Minute * 5), expected: now},
+		{t: now.Add(-Hour * 2).Add(Minute * 5), expected: now.Add(-Hour * 2)},
+		{t: now.Add(-Hour * 30), expected: legacy},
+		{t: legacy.Add(Hour - Second), expected: old},
+		{t: old.Add(-Second), err: ErrSnapshotNotFound},
+	}
+
+	for _, tc := range tcs {
+		key, err := s.keyAt(ctx, tc.t)
+		if err != tc.err {
+			t.Fatalf("invalid error for %v, expected %v and received %v", tc.t, tc.err, err)
+		}
+
+		if tc.err != nil {
+			continue
+		}
+
+		expected := codec.Encode("test", "txt", tc.expected)
+		if tc.expected.Equal(legacy) {
+			expected = legacyKey
+		}
+
+		if key != expected {
+			t.Fatalf("invalid key for %v, expected \"%s\" and received \"%s\"", tc.t, expected, key)
+		}
+	}
+
+	entries, err := s.entriesBetween(ctx, now.Add(-Hour*3), now.Add(-Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("invalid number of entries, expected %d and received %d", 3, len(entries))
+	}
+
+	for i, entry := range entries {
+		if expected := now.Add(-Hour * time.Duration(3-i)); !entry.time.Equal(expected) {
+			t.Fatalf("invalid entry time, expected %v and received %v", expected, entry.time)
+		}
+	}
+
+	// Ensure keys made by older versions are included when listing from the beginning
+	// Note: Keys without a manifest are treated as taken at the end of their truncation window
+	if entries, err = s.entriesBetween(ctx, time.Time{}, legacy.Add(Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[1].key != legacyKey {
+		t.Fatalf("invalid entries, expected the older key to follow the oldest snapshot and received %v", entries)
+	}
+}
+
+func TestSnapshotter_KeyAtTruncated(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Snapshot every minute, overwriting the snapshot of the current hour
+	cfg := NewConfig("test", "txt")
+	cfg.Interval = Minute
+	cfg.Truncate = Hour
+
+	// Initialize a Snapshotter without background loops
+	s := &Snapshotter{be: be, cfg: cfg, codec: DefaultKeyCodec}
+	ctx := context.Background()
+
+	write := func(key string, m *Manifest) {
+		if err := be.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if m == nil {
+			return
+		}
+
+		if err := s.setManifest(ctx, *m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The key of each hour holds the snapshot taken at the end of the hour
+	hour := time.Date(2026, time.October, 17, 14, 0, 0, 0, time.UTC)
+	for _, ts := range []time.Time{hour.Add(-Hour), hour} {
+		key := DefaultKeyCodec.Encode("test", "txt", ts)
+		write(key, &Manifest{Key: key, Start: ts.Add(Minute * 59), End: ts.Add(Minute * 59)})
+	}
+
+	// Keys made by older versions do not have a manifest
+	legacy := hour.Add(-Hour * 3)
+	legacyKey := fmt.Sprintf("test.%d.txt", legacy.Unix())
+	write(legacyKey, nil)
+
+	tcs := []struct {
+		t        time.Time
+		expected string
+		err      error
+	}{
+		{t: hour.Add(Minute * 5), expected: DefaultKeyCodec.Encode("test", "txt", hour.Add(-Hour))},
+		{t: hour.Add(Minute * 59), expected: DefaultKeyCodec.Encode("test", "txt", hour)},
+		{t: hour.Add(-Minute * 5), expected: legacyKey},
+		{t: legacy.Add(Minute * 30), err: ErrSnapshotNotFound},
+		{t: legacy.Add(Hour), expected: legacyKey},
+	}
+
+	for _, tc := range tcs {
+		key, err := s.keyAt(ctx, tc.t)
+		if err != tc.err {
+			t.Fatalf("invalid error for %v, expected %v and received %v", tc.t, tc.err, err)
+		}
+
+		if key != tc.expected {
+			t.Fatalf("invalid key for %v, expected \"%s\" and received \"%s\"", tc.t, tc.expected, key)
+		}
+	}
+
+	// Snapshots taken within the range are returned, even when their key precedes it
+	keys, err := s.entriesBetween(ctx, hour.Add(-Minute*30), hour.Add(Minute*30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := DefaultKeyCodec.Encode("test", "txt", hour.Add(-Hour)); len(keys) != 1 || keys[0].key != expected {
+		t.Fatalf("invalid entries, expected [%s] and received %v", expected, keys)
+	}
+}
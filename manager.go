@@ -0,0 +1,288 @@
+package snapshotter
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrJobExists is returned when a job is added with a name which is already registered
+	ErrJobExists = errors.Error("job with the provided name already exists")
+	// ErrJobNotFound is returned when a job cannot be found
+	ErrJobNotFound = errors.Error("job with the provided name was not found")
+	// ErrJobConflict is returned when a job is added with the configuration name of an existing job on the same back-end
+	ErrJobConflict = errors.Error("job with the provided configuration name already exists for the back-end")
+)
+
+// NewManager returns a new Manager which will run up to the provided number of snapshots at once
+// Note: A concurrency less than one will not limit snapshots
+func NewManager(concurrency int) *Manager {
+	return NewManagerWithContext(context.Background(), concurrency)
+}
+
+// NewManagerWithContext returns a new Manager whose jobs will stop when the provided context is cancelled
+func NewManagerWithContext(ctx context.Context, concurrency int) *Manager {
+	var m Manager
+	m.ctx = ctx
+	m.sem = newSemaphore(concurrency)
+	m.jobs = make(map[string]*job)
+	return &m
+}
+
+// Manager runs many named snapshot jobs, limiting the number of snapshots which run at once
+type Manager struct {
+	mu sync.RWMutex
+
+	ctx context.Context
+	// Semaphore shared by each job's Snapshotter
+	sem semaphore
+
+	jobs map[string]*job
+	// Closed state, jobs cannot be added once closed
+	closed bool
+}
+
+// JobStatus is the status of a single job
+type JobStatus struct {
+	Name string `json:"name"`
+
+	// Paused is whether or not scheduled snapshots are paused
+	Paused bool `json:"paused"`
+	// Running is whether or not a snapshot is currently being written
+	Running bool `json:"running"`
+	// NextRun is the time of the next scheduled snapshot
+	NextRun time.Time `json:"nextRun"`
+
+	// LastKey is the key of the most recent successful snapshot
+	LastKey string `json:"lastKey,omitempty"`
+	// LastSuccess is the time the most recent successful snapshot completed
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	// LastSize is the size of the most recent successful snapshot
+	LastSize int64 `json:"lastSize,omitempty"`
+	// LastDuration is the duration of the most recent successful snapshot
+	LastDuration time.Duration `json:"lastDuration,omitempty"`
+
+	// LastError is the error of the most recent failed snapshot
+	LastError string `json:"lastError,omitempty"`
+	// LastFailure is the time of the most recent failed snapshot
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+}
+
+// Add will register and start a new job
+// Note: Snapshots are stored under their configuration name, so jobs sharing a back-end must have
+// unique configuration names. Back-ends are compared by the back-end they decorate (if any)
+func (m *Manager) Add(name string, fe Frontend, be Backend, cfg Config) (s *Snapshotter, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, errors.ErrIsClosed
+	}
+
+	if _, ok := m.jobs[name]; ok {
+		return nil, ErrJobExists
+	}
+
+	for _, j := range m.jobs {
+		if j.s.cfg.Name == cfg.Name && sameBackend(j.s.be, be) {
+			// Jobs would overwrite (and purge) each other's snapshots, return
+			return nil, ErrJobConflict
+		}
+	}
+
+	if s, err = initSnapshotter(m.ctx, fe, be, cfg, m.sem); err != nil {
+		return
+	}
+
+	// Register the job's hooks before starting, so early events (such as a catch-up snapshot) are recorded
+	m.jobs[name] = newJob(name, s)
+	s.start()
+	return
+}
+
+// Remove will close and unregister a job
+func (m *Manager) Remove(name string) (err error) {
+	m.mu.Lock()
+	j, ok := m.jobs[name]
+	delete(m.jobs, name)
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	return j.s.Close()
+}
+
+// Get will return the Snapshotter of a job
+func (m *Manager) Get(name string) (s *Snapshotter, err error) {
+	var j *job
+	if j, err = m.get(name); err != nil {
+		return
+	}
+
+	return j.s, nil
+}
+
+// Pause will pause the scheduled snapshots of a job
+func (m *Manager) Pause(name string) (err error) {
+	var j *job
+	if j, err = m.get(name); err != nil {
+		return
+	}
+
+	j.s.Pause()
+	return
+}
+
+// Resume will resume the scheduled snapshots of a job
+func (m *Manager) Resume(name string) (err error) {
+	var j *job
+	if j, err = m.get(name); err != nil {
+		return
+	}
+
+	j.s.Resume()
+	return
+}
+
+// Status will return the status of every job, sorted by name
+func (m *Manager) Status() (statuses []JobStatus) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses = make([]JobStatus, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		statuses = append(statuses, j.status())
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return
+}
+
+// Close will close every job. Jobs are closed concurrently, their closing snapshots
+// are limited by the Manager's concurrency. Jobs cannot be added once closed
+func (m *Manager) Close() (err error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return errors.ErrIsClosed
+	}
+
+	m.closed = true
+	jobs := m.jobs
+	m.jobs = make(map[string]*job)
+	m.mu.Unlock()
+
+	var (
+		wg   sync.WaitGroup
+		emu  sync.Mutex
+		errs errors.ErrorList
+	)
+
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			if err := j.s.Close(); err != nil {
+				emu.Lock()
+				errs.Push(err)
+				emu.Unlock()
+			}
+		}(j)
+	}
+
+	wg.Wait()
+	return errs.Err()
+}
+
+func (m *Manager) get(name string) (j *job, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ok bool
+	if j, ok = m.jobs[name]; !ok {
+		return nil, ErrJobNotFound
+	}
+
+	return
+}
+
+// sameBackend will determine if the provided back-ends decorate (or are) the same back-end
+func sameBackend(a, b Backend) bool {
+	al, bl := layers(a), layers(b)
+	if len(al) == 0 || len(bl) == 0 {
+		return false
+	}
+
+	x, y := al[len(al)-1], bl[len(bl)-1]
+	if t := reflect.TypeOf(x); t != reflect.TypeOf(y) || !t.Comparable() {
+		// Back-ends of different or incomparable types cannot be the same, return
+		return false
+	}
+
+	return x == y
+}
+
+// newJob will return a new job which tracks the status of the provided Snapshotter
+func newJob(name string, s *Snapshotter) *job {
+	var j job
+	j.s = s
+	j.last.Name = name
+	s.OnSnapshotStart(j.onStart)
+	s.OnSnapshotComplete(j.onComplete)
+	s.OnSnapshotError(j.onError)
+	return &j
+}
+
+// job is a Snapshotter registered with a Manager
+type job struct {
+	mu sync.Mutex
+
+	s *Snapshotter
+	// Status recorded from the Snapshotter's hooks
+	last JobStatus
+}
+
+func (j *job) onStart(key string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.last.Running = true
+}
+
+func (j *job) onComplete(key string, size int64, duration time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.last.Running = false
+	j.last.LastKey = key
+	j.last.LastSuccess = time.Now()
+	j.last.LastSize = size
+	j.last.LastDuration = duration
+}
+
+func (j *job) onError(key string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.last.Running = false
+	j.last.LastError = err.Error()
+	j.last.LastFailure = time.Now()
+}
+
+// status will return the current status of the job
+func (j *job) status() (status JobStatus) {
+	j.mu.Lock()
+	status = j.last
+	j.mu.Unlock()
+
+	status.Paused = j.s.Paused()
+	status.NextRun = j.s.NextRun()
+	return
+}
@@ -0,0 +1,179 @@
+package snapshotter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+	"github.com/hatchify/errors"
+)
+
+func TestManager(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	m := NewManager(1)
+	defer m.Close()
+
+	fe := &testConcurrentFrontend{}
+	for _, name := range []string{"b", "a", "c"} {
+		// Set interval to an hour so only our manual snapshots will run
+		cfg := NewConfig(name, "txt")
+		cfg.Interval = Hour
+
+		if _, err := m.Add(name, fe, be, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := m.Add("a", fe, be, NewConfig("a", "txt")); err != ErrJobExists {
+		t.Fatalf("invalid error, expected %v and received %v", ErrJobExists, err)
+	}
+
+	// Jobs sharing a back-end (including through a decorator) cannot share a configuration name
+	cbe, err := NewCompressedBackend(be, CodecGzip, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []Backend{be, cbe} {
+		if _, err = m.Add("d", fe, b, NewConfig("a", "txt")); err != ErrJobConflict {
+			t.Fatalf("invalid error, expected %v and received %v", ErrJobConflict, err)
+		}
+	}
+
+	if _, err = m.Get("d"); err != ErrJobNotFound {
+		t.Fatalf("invalid error, expected %v and received %v", ErrJobNotFound, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c"} {
+		s, err := m.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Snapshot(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if max := fe.max.Load(); max != 1 {
+		t.Fatalf("invalid maximum concurrent snapshots, expected %d and received %d", 1, max)
+	}
+
+	if err := m.Pause("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := m.Status()
+	if len(statuses) != 3 {
+		t.Fatalf("invalid number of statuses, expected %d and received %d", 3, len(statuses))
+	}
+
+	for i, name := range []string{"a", "b", "c"} {
+		status := statuses[i]
+		if status.Name != name {
+			t.Fatalf("invalid status name, expected \"%s\" and received \"%s\"", name, status.Name)
+		}
+
+		if status.Paused != (name == "b") {
+			t.Fatalf("invalid paused state for \"%s\", received %v", name, status.Paused)
+		}
+
+		if status.Running || len(status.LastKey) == 0 || status.LastSuccess.IsZero() {
+			t.Fatalf("invalid status for \"%s\", received %+v", name, status)
+		}
+	}
+
+	if err := m.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Resume("b"); err != ErrJobNotFound {
+		t.Fatalf("invalid error, expected %v and received %v", ErrJobNotFound, err)
+	}
+
+	// Jobs on separate back-ends may share a configuration name
+	cfg := NewConfig("a", "txt")
+	cfg.Interval = Hour
+	if _, err := m.Add("d", fe, backends.NewFile(filepath.Join(backendTestDir, "d")), cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManager_Hooks(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	m := NewManager(1)
+
+	// Catch up immediately, the job must record the snapshot which runs as it starts
+	cfg := NewConfig("test", "txt")
+	cfg.Interval = Hour
+	cfg.CatchUp = true
+
+	if _, err := m.Add("test", &testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		statuses := m.Status()
+		return len(statuses) == 1 && len(statuses[0].LastKey) > 0 && !statuses[0].Running
+	})
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Add("test", &testFrontend{}, be, cfg); err != errors.ErrIsClosed {
+		t.Fatalf("invalid error, expected %v and received %v", errors.ErrIsClosed, err)
+	}
+
+	if err := m.Close(); err != errors.ErrIsClosed {
+		t.Fatalf("invalid error, expected %v and received %v", errors.ErrIsClosed, err)
+	}
+}
+
+// testConcurrentFrontend is a front-end which tracks the maximum number of concurrent copies
+type testConcurrentFrontend struct {
+	mu      sync.Mutex
+	current int64
+	max     atoms.Int64
+}
+
+// Copy will copy to an io.Writer
+func (f *testConcurrentFrontend) Copy(w io.Writer) (err error) {
+	f.mu.Lock()
+	f.current++
+	if f.current > f.max.Load() {
+		f.max.Store(f.current)
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.current--
+		f.mu.Unlock()
+	}()
+
+	// Hold the copy open long enough for other snapshots to overlap
+	time.Sleep(time.Millisecond * 50)
+	_, err = w.Write([]byte("hello world"))
+	return
+}
@@ -0,0 +1,167 @@
+package snapshotter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// manifestSuffix is appended to a snapshot key to form the key of it's manifest
+const manifestSuffix = ".manifest.json"
+
+// errNoManifest is returned when a snapshot does not have a manifest, snapshots made by older versions do not
+const errNoManifest = errors.Error("snapshot does not have a manifest")
+
+// sidecarSuffixes are the suffixes of the objects stored alongside each snapshot
+var sidecarSuffixes = []string{manifestSuffix, signatureSuffix}
+
+// Manifest is the metadata recorded for each snapshot
+type Manifest struct {
+	// Key of the snapshot
+	Key string `json:"key"`
+	// Name of the snapshotter configuration
+	Name string `json:"name"`
+
+	// Size of the snapshot in bytes, as written by the front-end
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot, as written by the front-end
+	SHA256 string `json:"sha256"`
+
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+
+	// Frontend is the type of the front-end which produced the snapshot
+	Frontend string `json:"frontend"`
+	// Host is the hostname of the machine which produced the snapshot
+	Host string `json:"host"`
+	// Version of snapshotter which produced the snapshot
+	Version string `json:"version"`
+
+	// Compression is the compression applied to the snapshot by the front-end (if any)
+	// Note: Compression applied by a back-end is identified by the back-end when reading
+	Compression string `json:"compression,omitempty"`
+	// Encryption is the encryption applied to the snapshot (if any)
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// Compressor is an optional interface for front-ends and back-ends which compress snapshots
+type Compressor interface {
+	Compression() string
+}
+
+// Encrypter is an optional interface for front-ends and back-ends which encrypt snapshots
+type Encrypter interface {
+	Encryption() string
+}
+
+// Stat will return the manifest of the provided snapshot key
+func (s *Snapshotter) Stat(key string) (m Manifest, err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		err = errors.ErrIsClosed
+		return
+	}
+
+	return s.getManifest(s.work, key)
+}
+
+// newManifest will return a new manifest for the provided key with the start time set to now
+func (s *Snapshotter) newManifest(key string) (m Manifest) {
+	m.Key = key
+	m.Name = s.cfg.Name
+	m.Start = time.Now()
+	m.Frontend = strings.TrimPrefix(fmt.Sprintf("%T", s.fe), "*")
+	m.Host, _ = os.Hostname()
+	m.Version = Version
+
+	// Check our front-end (and any layers it decorates) for compression, back-ends decompress their own values
+	for _, v := range layers(s.fe) {
+		if c, ok := v.(Compressor); ok {
+			m.Compression = c.Compression()
+			break
+		}
+	}
+
+	// Check our front-end and back-end (and any layers they decorate) for encryption settings
+	for _, v := range append(layers(s.fe), layers(s.be)...) {
+		if e, ok := v.(Encrypter); ok && len(m.Encryption) == 0 {
+			m.Encryption = e.Encryption()
+		}
+	}
+
+	return
+}
+
+func (s *Snapshotter) getManifest(ctx context.Context, key string) (m Manifest, err error) {
+	err = readFrom(ctx, s.be, key+manifestSuffix, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&m)
+	})
+
+	return
+}
+
+// lookupManifest will return the manifest of the provided key. errNoManifest is only returned when the
+// manifest does not exist, other errors (such as a transient back-end failure) are returned as-is
+func (s *Snapshotter) lookupManifest(ctx context.Context, key string) (m Manifest, err error) {
+	if m, err = s.getManifest(ctx, key); err == nil {
+		return
+	}
+
+	// Back-ends report missing keys differently, check whether or not the manifest exists by listing it
+	if exists, eerr := keyExists(ctx, s.be, key+manifestSuffix); eerr == nil && !exists {
+		err = errNoManifest
+	}
+
+	return
+}
+
+func (s *Snapshotter) setManifest(ctx context.Context, m Manifest) (err error) {
+	return writeManifest(ctx, s.be, m)
+}
+
+// writeManifest will write the provided manifest alongside the snapshot it describes
+func writeManifest(ctx context.Context, be Backend, m Manifest) (err error) {
+	err = writeTo(ctx, be, m.Key+manifestSuffix, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(m)
+	})
+
+	return
+}
+
+// isSidecar will return whether or not the provided key is an object stored alongside a snapshot
+func isSidecar(key string) bool {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// layers will return the provided value along with every front-end or back-end it decorates
+func layers(v interface{}) (out []interface{}) {
+	for v != nil {
+		out = append(out, v)
+		switch u := v.(type) {
+		case interface{ Unwrap() Backend }:
+			v = u.Unwrap()
+		case interface{ Unwrap() Frontend }:
+			v = u.Unwrap()
+		default:
+			v = nil
+		}
+	}
+
+	return
+}
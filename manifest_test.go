@@ -0,0 +1,63 @@
+package snapshotter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestSnapshotter_Stat(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	var m Manifest
+	if m, err = s.Stat(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("hello world"))
+	if expected := hex.EncodeToString(sum[:]); m.SHA256 != expected {
+		t.Fatalf("invalid checksum, expected \"%s\" and received \"%s\"", expected, m.SHA256)
+	}
+
+	if m.Size != int64(len("hello world")) {
+		t.Fatalf("invalid size, expected %d and received %d", len("hello world"), m.Size)
+	}
+
+	if m.Key != latest || m.Name != "test" || m.Version != Version {
+		t.Fatalf("invalid manifest: %+v", m)
+	}
+
+	if m.Frontend != "snapshotter.testFrontend" {
+		t.Fatalf("invalid front-end, expected \"%s\" and received \"%s\"", "snapshotter.testFrontend", m.Frontend)
+	}
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdbu/snapshotter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "snapshotter"
+
+var labels = []string{"name", "backend"}
+
+// New will return a new instance of Metrics
+func New() *Metrics {
+	var m Metrics
+	m.attempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snapshot_attempts_total",
+		Help:      "Total number of snapshot attempts.",
+	}, labels)
+
+	m.successes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snapshot_successes_total",
+		Help:      "Total number of successful snapshots.",
+	}, labels)
+
+	m.failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snapshot_failures_total",
+		Help:      "Total number of failed snapshots.",
+	}, labels)
+
+	m.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "snapshot_duration_seconds",
+		Help:      "Duration of successful snapshots.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, labels)
+
+	m.size = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "snapshot_size_bytes",
+		Help:      "Number of bytes written by the most recent successful snapshot.",
+	}, labels)
+
+	m.written = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snapshot_written_bytes_total",
+		Help:      "Total number of bytes written by successful snapshots.",
+	}, labels)
+
+	m.purged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purge_deletions_total",
+		Help:      "Total number of keys deleted by purges.",
+	}, labels)
+
+	m.lastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix timestamp of the most recent successful snapshot.",
+	}, labels)
+
+	m.latestAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "latest_key_age_seconds"),
+		"Age of the latest snapshot key, based on the timestamp within the key.",
+		labels, nil,
+	)
+
+	m.latest = make(map[watched]time.Time)
+	m.registry = prometheus.NewRegistry()
+	m.registry.MustRegister(&m)
+	return &m
+}
+
+// Metrics records snapshotter events as prometheus metrics
+type Metrics struct {
+	mu sync.RWMutex
+
+	attempts    *prometheus.CounterVec
+	successes   *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	size        *prometheus.GaugeVec
+	written     *prometheus.CounterVec
+	purged      *prometheus.CounterVec
+	lastSuccess *prometheus.GaugeVec
+	latestAge   *prometheus.Desc
+
+	// Timestamp of the latest key for each watched snapshotter
+	latest map[watched]time.Time
+
+	registry *prometheus.Registry
+}
+
+// watched is the label pair for a watched snapshotter
+type watched struct {
+	name    string
+	backend string
+}
+
+func (m *Metrics) setLatest(w watched, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latest[w] = t
+}
+
+// Watch will record the events of the provided snapshotter
+// Note: Events emitted before Watch is called are not recorded, use snapshotter.NewUnstarted and
+// call Watch before starting the snapshotter to record events which occur as it starts
+func (m *Metrics) Watch(s *snapshotter.Snapshotter) {
+	w := watched{
+		name:    s.Name(),
+		backend: backendType(s.Backend()),
+	}
+
+	// Initialize our counters so they are reported before the first event
+	m.attempts.WithLabelValues(w.name, w.backend)
+	m.successes.WithLabelValues(w.name, w.backend)
+	m.failures.WithLabelValues(w.name, w.backend)
+	m.purged.WithLabelValues(w.name, w.backend)
+
+	// Seed the latest key timestamp from the back-end
+	if key, err := s.LatestKey(); err == nil {
+		if t, err := s.KeyTime(key); err == nil {
+			m.setLatest(w, t)
+		}
+	}
+
+	s.OnSnapshotStart(func(key string) {
+		m.attempts.WithLabelValues(w.name, w.backend).Inc()
+	})
+
+	s.OnSnapshotComplete(func(key string, size int64, duration time.Duration) {
+		m.successes.WithLabelValues(w.name, w.backend).Inc()
+		m.duration.WithLabelValues(w.name, w.backend).Observe(duration.Seconds())
+		m.size.WithLabelValues(w.name, w.backend).Set(float64(size))
+		m.written.WithLabelValues(w.name, w.backend).Add(float64(size))
+		m.lastSuccess.WithLabelValues(w.name, w.backend).SetToCurrentTime()
+
+		if t, err := s.KeyTime(key); err == nil {
+			m.setLatest(w, t)
+		}
+	})
+
+	s.OnSnapshotError(func(key string, err error) {
+		if len(key) == 0 {
+			// Snapshot failed before it's key was chosen (e.g. waiting for a concurrency slot), so
+			// no start was emitted. Record the attempt so failures never exceed attempts
+			m.attempts.WithLabelValues(w.name, w.backend).Inc()
+		}
+
+		m.failures.WithLabelValues(w.name, w.backend).Inc()
+	})
+
+	s.OnPurge(func(key string) {
+		m.purged.WithLabelValues(w.name, w.backend).Inc()
+	})
+}
+
+// Describe will send the metric descriptions to the provided channel
+// Note: This fulfills the prometheus.Collector interface
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.attempts.Describe(ch)
+	m.successes.Describe(ch)
+	m.failures.Describe(ch)
+	m.duration.Describe(ch)
+	m.size.Describe(ch)
+	m.written.Describe(ch)
+	m.purged.Describe(ch)
+	m.lastSuccess.Describe(ch)
+	ch <- m.latestAge
+}
+
+// Collect will send the current metric values to the provided channel
+// Note: This fulfills the prometheus.Collector interface
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.attempts.Collect(ch)
+	m.successes.Collect(ch)
+	m.failures.Collect(ch)
+	m.duration.Collect(ch)
+	m.size.Collect(ch)
+	m.written.Collect(ch)
+	m.purged.Collect(ch)
+	m.lastSuccess.Collect(ch)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	for w, t := range m.latest {
+		age := now.Sub(t).Seconds()
+		ch <- prometheus.MustNewConstMetric(m.latestAge, prometheus.GaugeValue, age, w.name, w.backend)
+	}
+}
+
+// Handler will return an http.Handler which serves the metrics in the prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// backendType will return the type name of the provided back-end (e.g. "backends.S3")
+func backendType(be snapshotter.Backend) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", be), "*")
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gdbu/snapshotter"
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	var (
+		s   *snapshotter.Snapshotter
+		dir string
+		err error
+	)
+
+	if dir, err = ioutil.TempDir("", "snapshotter_metrics"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := snapshotter.NewConfig("test", "txt")
+	cfg.Interval = snapshotter.Hour
+
+	if s, err = snapshotter.New(testFrontend{}, backends.NewFile(dir), cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	m := New()
+	m.Watch(s)
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.ToFloat64(m.successes.WithLabelValues("test", "backends.File")); n != 1 {
+		t.Fatalf("invalid success count, expected %d and received %v", 1, n)
+	}
+
+	if n := testutil.ToFloat64(m.size.WithLabelValues("test", "backends.File")); n != float64(len("hello world")) {
+		t.Fatalf("invalid size, expected %d and received %v", len("hello world"), n)
+	}
+}
+
+func TestMetrics_FailureBeforeKey(t *testing.T) {
+	var (
+		s   *snapshotter.Snapshotter
+		dir string
+		err error
+	)
+
+	if dir, err = ioutil.TempDir("", "snapshotter_metrics"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Skipped collisions list the back-end before choosing a key, fail the list
+	cfg := snapshotter.NewConfig("test", "txt")
+	cfg.Interval = snapshotter.Hour
+	cfg.CollisionPolicy = snapshotter.CollisionSkip
+
+	be := &testFailingListBackend{Backend: backends.NewFile(dir)}
+	if s, err = snapshotter.NewUnstarted(context.Background(), testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	m := New()
+	m.Watch(s)
+
+	if err = s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Snapshot(); err != errTestList {
+		t.Fatalf("invalid error, expected %v and received %v", errTestList, err)
+	}
+
+	attempts := testutil.ToFloat64(m.attempts.WithLabelValues("test", "metrics.testFailingListBackend"))
+	failures := testutil.ToFloat64(m.failures.WithLabelValues("test", "metrics.testFailingListBackend"))
+	if failures == 0 || attempts != failures {
+		t.Fatalf("invalid counts, expected matching attempts and failures and received %v attempts and %v failures", attempts, failures)
+	}
+}
+
+type testFrontend struct{}
+
+func (testFrontend) Copy(w io.Writer) (err error) {
+	_, err = w.Write([]byte("hello world"))
+	return
+}
+
+var errTestList = errors.New("list failure")
+
+// testFailingListBackend is a back-end which fails every list
+type testFailingListBackend struct {
+	snapshotter.Backend
+}
+
+func (f *testFailingListBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return nil, errTestList
+}
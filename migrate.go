@@ -0,0 +1,314 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrSignedMigration is returned when migrating signed snapshots without a signing key
+const ErrSignedMigration = errors.Error("snapshots are signed, a signing key is required to migrate them")
+
+// MigrateFn is called for each snapshot renamed by MigrateKeys
+type MigrateFn func(oldKey, newKey string) error
+
+// MigrateKeys will rename the snapshots of the provided name and extension (along with their sidecars
+// and latest key) to the keys produced by the provided codec. Snapshots made by older versions, including
+// those whose name or extension contain dots, are recognized
+// Note: Snapshotters using the back-end should be stopped during a migration. Signatures are bound to the
+// key they were made for, so signed snapshots are re-signed for their new key using the provided signing
+// key. If any of the snapshots are signed and no signing key is provided, ErrSignedMigration is returned
+// before any snapshots are renamed
+func MigrateKeys(ctx context.Context, be Backend, name, ext string, codec KeyCodec, signingKey ed25519.PrivateKey, fn MigrateFn) (err error) {
+	var renames map[string]string
+	if renames, err = migrationRenames(ctx, be, name, ext, codec); err != nil {
+		return
+	}
+
+	// Sort the keys so renames are performed in a deterministic order
+	oldKeys := make([]string, 0, len(renames))
+	for oldKey := range renames {
+		oldKeys = append(oldKeys, oldKey)
+	}
+
+	sort.Strings(oldKeys)
+
+	if signingKey == nil {
+		// Ensure none of the snapshots are signed before renaming anything
+		for _, oldKey := range oldKeys {
+			var signed bool
+			if signed, err = keyExists(ctx, be, oldKey+signatureSuffix); err != nil {
+				return
+			}
+
+			if signed {
+				return ErrSignedMigration
+			}
+		}
+	}
+
+	for _, oldKey := range oldKeys {
+		newKey := renames[oldKey]
+		if err = moveKey(ctx, be, oldKey, newKey); err != nil {
+			return
+		}
+
+		if err = migrateSidecars(ctx, be, oldKey, newKey, signingKey); err != nil {
+			return
+		}
+
+		if fn == nil {
+			continue
+		}
+
+		if err = fn(oldKey, newKey); err != nil {
+			return
+		}
+	}
+
+	return migrateLatest(ctx, be, name, codec, renames)
+}
+
+// migrateSidecars will move the manifest and signature of a renamed snapshot so they reference it's new key
+// Note: Snapshots made by older versions will not have sidecars
+func migrateSidecars(ctx context.Context, be Backend, oldKey, newKey string, signingKey ed25519.PrivateKey) (err error) {
+	var (
+		m   Manifest
+		sig Signature
+		ok  bool
+	)
+
+	if ok, err = readSidecar(ctx, be, oldKey+manifestSuffix, &m); err != nil {
+		return
+	} else if ok {
+		m.Key = newKey
+		if err = writeManifest(ctx, be, m); err != nil {
+			return
+		}
+
+		if err = deleteKey(ctx, be, oldKey+manifestSuffix); err != nil {
+			return
+		}
+	}
+
+	if ok, err = readSidecar(ctx, be, oldKey+signatureSuffix, &sig); err != nil || !ok {
+		return
+	}
+
+	if signingKey == nil {
+		// Snapshot was signed after our initial check, return
+		return ErrSignedMigration
+	}
+
+	// The signed checksum was made by the front-end, the snapshot contents are unchanged by a rename
+	if err = setSignature(ctx, be, newKey, newSignature(signingKey, newKey, sig.Compression, sig.SHA256)); err != nil {
+		return
+	}
+
+	return deleteKey(ctx, be, oldKey+signatureSuffix)
+}
+
+// readSidecar will decode the sidecar stored at the provided key, ok is false when the sidecar does not exist
+func readSidecar(ctx context.Context, be Backend, key string, value interface{}) (ok bool, err error) {
+	if ok, err = keyExists(ctx, be, key); err != nil || !ok {
+		return
+	}
+
+	err = readFrom(ctx, be, key, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(value)
+	})
+
+	return
+}
+
+// migrationRenames will return the new key for each snapshot which does not match the provided codec
+func migrationRenames(ctx context.Context, be Backend, name, ext string, codec KeyCodec) (renames map[string]string, err error) {
+	renames = make(map[string]string)
+	prefixes := []string{name}
+	if escaped := escapeKeyComponent(name); escaped != name {
+		prefixes = append(prefixes, escaped)
+	}
+
+	for _, prefix := range prefixes {
+		var marker string
+		for {
+			var keys []string
+			if keys, err = list(ctx, be, prefix, marker, purgePageSize); err != nil {
+				return
+			}
+
+			for _, key := range keys {
+				if isSidecar(key) {
+					// Sidecars are moved alongside their snapshot, continue
+					continue
+				}
+
+				t, seq, ok := decodeMigrationKey(key, name, ext, codec)
+				if !ok {
+					// Key does not belong to us, continue
+					continue
+				}
+
+				newKey := codec.Encode(name, ext, t)
+				if seq > 0 {
+					sc, ok := codec.(SequenceCodec)
+					if !ok {
+						// Sequenced keys cannot be represented by the target codec, continue
+						continue
+					}
+
+					newKey = sc.EncodeSequence(name, ext, t, seq)
+				}
+
+				if newKey != key {
+					renames[key] = newKey
+				}
+			}
+
+			if len(keys) < purgePageSize {
+				break
+			}
+
+			// Set marker as the last key we've seen
+			marker = keys[len(keys)-1]
+		}
+	}
+
+	return
+}
+
+// migrateLatest will move the latest key to the key produced by the provided codec and
+// update it to reference the renamed snapshot
+func migrateLatest(ctx context.Context, be Backend, name string, codec KeyCodec, renames map[string]string) (err error) {
+	target := codec.Latest(name)
+	candidates := []string{
+		// Latest key made by older versions
+		name + keySeparator + latestToken + keySeparator + latestExtension,
+		KeyFormat{Layout: LayoutFlat}.Latest(name),
+		KeyFormat{Layout: LayoutDay}.Latest(name),
+	}
+
+	// A latest key written by the target codec takes precedence over previous latest keys
+	latest, rerr := readLatest(ctx, be, target)
+	found := rerr == nil
+
+	var stale []string
+	seen := map[string]bool{target: true}
+	for _, candidate := range candidates {
+		if seen[candidate] {
+			// Older latest keys match the flat latest key when the name has no escaped characters
+			continue
+		}
+
+		seen[candidate] = true
+
+		value, rerr := readLatest(ctx, be, candidate)
+		if rerr != nil {
+			// Candidate does not exist, continue
+			continue
+		}
+
+		if !found {
+			latest = value
+			found = true
+		}
+
+		stale = append(stale, candidate)
+	}
+
+	if !found {
+		// No latest key was found, return
+		return
+	}
+
+	if renamed, ok := renames[latest]; ok {
+		latest = renamed
+	}
+
+	if err = writeTo(ctx, be, target, func(w io.Writer) (err error) {
+		_, err = w.Write([]byte(latest))
+		return
+	}); err != nil {
+		return
+	}
+
+	for _, key := range stale {
+		if err = deleteKey(ctx, be, key); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// decodeMigrationKey will return the time and sequence number of a key belonging to the provided name and extension
+func decodeMigrationKey(key, name, ext string, codec KeyCodec) (t time.Time, seq int, ok bool) {
+	// Older versions did not escape the name or extension, so the key is parsed using
+	// the known name and extension rather than splitting on dots
+	legacyPrefix := name + keySeparator
+	legacySuffix := keySeparator + ext
+	if strings.HasPrefix(key, legacyPrefix) && strings.HasSuffix(key, legacySuffix) && len(key) > len(legacyPrefix)+len(legacySuffix) {
+		middle := key[len(legacyPrefix) : len(key)-len(legacySuffix)]
+		if unixTS, err := strconv.ParseInt(middle, 10, 64); err == nil {
+			return time.Unix(unixTS, 0), 0, true
+		}
+	}
+
+	for _, c := range []KeyCodec{codec, DefaultKeyCodec} {
+		var (
+			kname, kext string
+			kt          time.Time
+			kseq        int
+			err         error
+		)
+
+		if sc, isSequence := c.(SequenceCodec); isSequence {
+			kname, kext, kt, kseq, err = sc.DecodeSequence(key)
+		} else {
+			kname, kext, kt, err = c.Decode(key)
+		}
+
+		if err == nil && kname == name && kext == ext {
+			return kt, kseq, true
+		}
+	}
+
+	return
+}
+
+// moveKey will copy the value of a key to a new key and delete the original
+func moveKey(ctx context.Context, be Backend, oldKey, newKey string) (err error) {
+	if err = writeTo(ctx, be, newKey, func(w io.Writer) error {
+		return readFrom(ctx, be, oldKey, func(r io.Reader) (err error) {
+			_, err = io.Copy(w, r)
+			return
+		})
+	}); err != nil {
+		return
+	}
+
+	return deleteKey(ctx, be, oldKey)
+}
+
+// readLatest will read the value of a latest key
+func readLatest(ctx context.Context, be Backend, key string) (latest string, err error) {
+	err = readFrom(ctx, be, key, func(r io.Reader) (err error) {
+		buf := bytes.NewBuffer(nil)
+		if _, err = io.Copy(buf, r); err != nil {
+			return
+		}
+
+		latest = buf.String()
+		return
+	})
+
+	return
+}
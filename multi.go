@@ -0,0 +1,659 @@
+package snapshotter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hatchify/atoms"
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrNoReplicas is returned when a MultiBackend is created without any back-ends
+	ErrNoReplicas = errors.Error("at least one replica back-end is required")
+	// ErrInvalidQuorum is returned when a quorum is negative or larger than the number of replicas
+	ErrInvalidQuorum = errors.Error("invalid quorum, must be between zero and the number of replicas")
+	// ErrNotSizer is returned when none of the replicas can report the size of a key
+	ErrNotSizer = errors.Error("no replica implements Sizer")
+	// ErrReplicaStalled is reported for a replica which stopped accepting data and was cancelled
+	ErrReplicaStalled = errors.Error("replica stopped accepting data and was cancelled")
+)
+
+// errQuorumLost is returned to the write function once too many replicas have failed to reach quorum
+const errQuorumLost = errors.Error("too many replicas have failed to reach quorum")
+
+const (
+	// QuorumAll requires every replica to succeed
+	QuorumAll = 0
+	// QuorumAny requires a single replica to succeed
+	QuorumAny = 1
+)
+
+const (
+	// multiChunkSize is the maximum size of a chunk passed to a replica
+	multiChunkSize = 32 * 1024
+	// defaultMultiBufferSize is the default number of bytes buffered for each replica
+	defaultMultiBufferSize = 4 * 1024 * 1024
+	// defaultStallTimeout is the default duration a replica may go without accepting data
+	defaultStallTimeout = Minute
+)
+
+// MultiOptions are the options for a MultiBackend
+type MultiOptions struct {
+	// Quorum is the number of replicas which must succeed, QuorumAll and QuorumAny may be used
+	Quorum int
+	// BufferSize is the number of bytes buffered for each replica, a replica with a full buffer is falling behind
+	// Note: A value of zero will default to 4MB
+	BufferSize int
+	// StallTimeout is how long a replica may go without accepting data before it is considered stalled.
+	// A stalled replica is cancelled as long as quorum can still be reached without it
+	// Note: A value of zero will default to one minute
+	StallTimeout time.Duration
+}
+
+// ReplicaErrorFn is called when a replica fails, including when the operation still reached quorum
+type ReplicaErrorFn func(replica int, key string, err error)
+
+// NewMultiBackend returns a back-end which replicates each write to every provided back-end
+func NewMultiBackend(opts MultiOptions, replicas ...Backend) (mp *MultiBackend, err error) {
+	var m MultiBackend
+	if len(replicas) == 0 {
+		err = ErrNoReplicas
+		return
+	}
+
+	if opts.Quorum < 0 || opts.Quorum > len(replicas) {
+		err = ErrInvalidQuorum
+		return
+	}
+
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultMultiBufferSize
+	}
+
+	if opts.StallTimeout <= 0 {
+		opts.StallTimeout = defaultStallTimeout
+	}
+
+	m.replicas = replicas
+	m.opts = opts
+	m.lagging = make(map[string]map[int]bool)
+	mp = &m
+	return
+}
+
+// MultiBackend is a back-end which replicates to several back-ends
+// Writes are streamed to every replica concurrently and succeed once the quorum has been reached,
+// reads are served by the first replica which has the key and did not miss it's most recent write
+// Note: Missed writes are tracked in memory, so a replica which missed a write before a restart may
+// serve a stale value (e.g. an outdated latest key) until the key is written again
+type MultiBackend struct {
+	mu sync.RWMutex
+
+	replicas []Backend
+	opts     MultiOptions
+
+	// Replicas which failed the most recent write of each key, these may hold a stale value
+	lagging map[string]map[int]bool
+
+	onReplicaError []ReplicaErrorFn
+}
+
+// ReplicaError is the failure of a single replica
+type ReplicaError struct {
+	Replica int
+	Err     error
+}
+
+// ReplicationError is returned when an operation did not reach quorum
+type ReplicationError struct {
+	Key       string
+	Succeeded int
+	Quorum    int
+	Failures  []ReplicaError
+}
+
+// Error will return the error message
+func (r *ReplicationError) Error() string {
+	msgs := make([]string, 0, len(r.Failures))
+	for _, failure := range r.Failures {
+		msgs = append(msgs, fmt.Sprintf("replica %d: %v", failure.Replica, failure.Err))
+	}
+
+	return fmt.Sprintf("error replicating \"%s\", %d of %d required replicas succeeded (%s)", r.Key, r.Succeeded, r.Quorum, strings.Join(msgs, "; "))
+}
+
+// OnReplicaError will register a function to be called when a replica fails
+func (m *MultiBackend) OnReplicaError(fn ReplicaErrorFn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onReplicaError = append(m.onReplicaError, fn)
+}
+
+// WriteTo will pass a writer to the provided function
+func (m *MultiBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return m.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will pass a writer to the provided function, everything written is streamed to each replica
+// Note: Each replica is written to by it's own goroutine through a bounded buffer, so a slow replica
+// only slows the write once it's buffer is full. A replica which stalls is cancelled as long as
+// quorum can still be reached without it
+func (m *MultiBackend) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	fw := newFanoutWriter(ctx, m.required(), m.opts)
+	defer fw.cancel()
+
+	for _, be := range m.replicas {
+		fw.start(be, key)
+	}
+
+	ferr := fn(fw)
+	errs := fw.close(ferr)
+	if ferr != nil && ferr != errQuorumLost {
+		return ferr
+	}
+
+	// Replicas which succeeded now hold the newest value, record the replicas which did not
+	m.setLagging(key, errs)
+	return m.evaluate(key, errs)
+}
+
+// ReadFrom will pass a reader to the provided function
+func (m *MultiBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return m.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will pass a reader from the first healthy replica to the provided function
+// Note: Once the function has been called, it's error is returned rather than trying the next replica.
+// Replicas which missed the most recent write of the key are not read, as their value may be stale
+func (m *MultiBackend) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	lagging := m.getLagging(key)
+	for i, be := range m.replicas {
+		if lagging[i] {
+			// Replica missed the most recent write of this key, continue
+			continue
+		}
+
+		var called bool
+		if err = readFrom(ctx, be, key, func(r io.Reader) error {
+			called = true
+			return fn(r)
+		}); err == nil || called || ctx.Err() != nil {
+			return
+		}
+
+		m.emitReplicaError(i, key, err)
+	}
+
+	return
+}
+
+// Delete will delete a key
+func (m *MultiBackend) Delete(key string) (err error) {
+	return m.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will delete a key from each replica
+// Note: A replica which does not have the key is considered successful, as the key may not
+// have reached every replica when it was written
+func (m *MultiBackend) DeleteContext(ctx context.Context, key string) (err error) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.replicas))
+	for i, be := range m.replicas {
+		wg.Add(1)
+		go func(i int, be Backend) {
+			defer wg.Done()
+			if errs[i] = deleteKey(ctx, be, key); os.IsNotExist(errs[i]) {
+				errs[i] = nil
+			}
+		}(i, be)
+	}
+
+	wg.Wait()
+	if err = m.evaluate(key, errs); err == nil {
+		// Key no longer exists within any replica we can read from, lagging replicas are no longer relevant
+		m.setLagging(key, nil)
+	}
+
+	return
+}
+
+// List will list the available keys
+func (m *MultiBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return m.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the keys available within any replica
+// Note: An error is only returned when every replica fails
+func (m *MultiBackend) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.replicas))
+	lists := make([][]string, len(m.replicas))
+	for i, be := range m.replicas {
+		wg.Add(1)
+		go func(i int, be Backend) {
+			defer wg.Done()
+			lists[i], errs[i] = list(ctx, be, prefix, marker, maxKeys)
+		}(i, be)
+	}
+
+	wg.Wait()
+
+	var succeeded int
+	seen := make(map[string]bool)
+	for i, replicaKeys := range lists {
+		if errs[i] != nil {
+			m.emitReplicaError(i, prefix, errs[i])
+			err = errs[i]
+			continue
+		}
+
+		succeeded++
+		for _, key := range replicaKeys {
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if succeeded == 0 {
+		return
+	}
+
+	sort.Strings(keys)
+	if maxKeys > -1 && int64(len(keys)) > maxKeys {
+		keys = keys[:maxKeys]
+	}
+
+	return keys, nil
+}
+
+// Next will return the next key
+func (m *MultiBackend) Next(prefix, marker string) (nextKey string, err error) {
+	return m.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key available within any replica
+func (m *MultiBackend) NextContext(ctx context.Context, prefix, marker string) (nextKey string, err error) {
+	var keys []string
+	if keys, err = m.ListContext(ctx, prefix, marker, 1); err != nil {
+		return
+	}
+
+	if len(keys) == 0 {
+		return "", io.EOF
+	}
+
+	return keys[0], nil
+}
+
+// Size will return the size of a key from the first replica which can report it
+// Note: Replicas which missed the most recent write of the key are skipped
+func (m *MultiBackend) Size(key string) (size int64, err error) {
+	err = ErrNotSizer
+	lagging := m.getLagging(key)
+	for i, be := range m.replicas {
+		if lagging[i] {
+			continue
+		}
+
+		sizer, ok := be.(Sizer)
+		if !ok {
+			continue
+		}
+
+		if size, err = sizer.Size(key); err == nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Replicas will return the replica back-ends
+func (m *MultiBackend) Replicas() []Backend {
+	return m.replicas
+}
+
+// required will return the number of replicas which must succeed
+func (m *MultiBackend) required() int {
+	if m.opts.Quorum == QuorumAll {
+		return len(m.replicas)
+	}
+
+	return m.opts.Quorum
+}
+
+// setLagging will record the replicas which failed the most recent write of a key
+// Note: When every replica failed, none of them hold a newer value and nothing is recorded
+func (m *MultiBackend) setLagging(key string, errs []error) {
+	lagging := make(map[int]bool)
+	for i, err := range errs {
+		if err != nil {
+			lagging[i] = true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch len(lagging) {
+	case 0:
+		// Every replica is up to date, remove the key
+		delete(m.lagging, key)
+	case len(m.replicas):
+		// Write did not reach any replica, the previous state is unchanged
+
+	default:
+		m.lagging[key] = lagging
+	}
+}
+
+// getLagging will return the replicas which failed the most recent write of a key (if any)
+func (m *MultiBackend) getLagging(key string) (lagging map[int]bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lagging[key]
+}
+
+// evaluate will report the failed replicas and return an error if quorum was not reached
+func (m *MultiBackend) evaluate(key string, errs []error) (err error) {
+	var rerr ReplicationError
+	for i, replicaErr := range errs {
+		if replicaErr == nil {
+			rerr.Succeeded++
+			continue
+		}
+
+		rerr.Failures = append(rerr.Failures, ReplicaError{Replica: i, Err: replicaErr})
+		m.emitReplicaError(i, key, replicaErr)
+	}
+
+	if rerr.Quorum = m.required(); rerr.Succeeded >= rerr.Quorum {
+		return
+	}
+
+	rerr.Key = key
+	return &rerr
+}
+
+// emitReplicaError will call the replica error functions
+// Note: The functions are called without holding the lock, so they may register other functions
+func (m *MultiBackend) emitReplicaError(replica int, key string, err error) {
+	m.mu.RLock()
+	fns := m.onReplicaError
+	m.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(replica, key, err)
+	}
+}
+
+// newFanoutWriter will return a writer which streams to replicas, of which the provided number must succeed
+func newFanoutWriter(ctx context.Context, required int, opts MultiOptions) *fanoutWriter {
+	var f fanoutWriter
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	f.required = required
+	f.chunkSize = multiChunkSize
+	if opts.BufferSize < f.chunkSize {
+		f.chunkSize = opts.BufferSize
+	}
+
+	f.bufferLen = opts.BufferSize / f.chunkSize
+	f.stallTimeout = opts.StallTimeout
+	return &f
+}
+
+// fanoutWriter streams to several replicas, unlike io.MultiWriter a failed or stalled replica
+// is dropped rather than failing the write, until too few replicas remain to reach quorum
+// Note: A fanoutWriter is not safe for concurrent use
+type fanoutWriter struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	replicas []*replicaStream
+
+	required     int
+	chunkSize    int
+	bufferLen    int
+	stallTimeout time.Duration
+}
+
+// start will begin writing to the provided replica
+func (f *fanoutWriter) start(be Backend, key string) {
+	var r replicaStream
+	r.chunks = make(chan []byte, f.bufferLen)
+	r.done = make(chan struct{})
+	r.lastRead.Store(time.Now().UnixNano())
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(f.ctx)
+	f.replicas = append(f.replicas, &r)
+
+	go func() {
+		defer close(r.done)
+		r.err = writeTo(ctx, be, key, func(w io.Writer) (err error) {
+			_, err = io.Copy(w, &r)
+			return
+		})
+	}()
+}
+
+// Write will pass a copy of the provided bytes to each replica which has not failed
+func (f *fanoutWriter) Write(bs []byte) (n int, err error) {
+	for len(bs) > 0 {
+		size := len(bs)
+		if size > f.chunkSize {
+			size = f.chunkSize
+		}
+
+		// Replicas read the chunk after Write has returned, so it cannot reference the caller's buffer
+		chunk := make([]byte, size)
+		copy(chunk, bs)
+
+		for _, r := range f.replicas {
+			if r.finished {
+				continue
+			}
+
+			if err = f.send(r, chunk); err != nil {
+				return
+			}
+		}
+
+		if f.viable() < f.required {
+			err = errQuorumLost
+			return
+		}
+
+		bs = bs[size:]
+		n += size
+	}
+
+	return
+}
+
+// send will pass a chunk to a replica. When the replica's buffer is full, send waits for the replica
+// to accept the chunk. A replica which does not accept the chunk within the stall timeout is dropped,
+// as long as quorum can still be reached without it
+func (f *fanoutWriter) send(r *replicaStream, chunk []byte) (err error) {
+	select {
+	case r.chunks <- chunk:
+		return
+	case <-r.done:
+		// Replica has returned, it will not read any further
+		f.finish(r, r.err)
+		return
+	default:
+	}
+
+	// Buffer is full, the replica is falling behind
+	timer := time.NewTimer(f.stallTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case r.chunks <- chunk:
+			return
+		case <-r.done:
+			f.finish(r, r.err)
+			return
+		case <-f.ctx.Done():
+			return f.ctx.Err()
+		case <-timer.C:
+		}
+
+		if f.viable()-1 >= f.required {
+			// Quorum can be reached without the stalled replica, drop it
+			f.drop(r, ErrReplicaStalled)
+			return
+		}
+
+		// Quorum cannot be reached without the replica, continue waiting
+		timer.Reset(f.stallTimeout)
+	}
+}
+
+// close will close each replica's stream with the provided error and wait for the replicas to return
+// Note: A nil error signals the end of the stream. Replicas which stall are dropped as long as quorum
+// can be reached without them, or when the stream was closed with an error
+func (f *fanoutWriter) close(ferr error) (errs []error) {
+	for _, r := range f.replicas {
+		f.closeStream(r, ferr)
+	}
+
+	for _, r := range f.replicas {
+		if !r.finished {
+			f.wait(r, ferr != nil)
+		}
+	}
+
+	errs = make([]error, 0, len(f.replicas))
+	for _, r := range f.replicas {
+		errs = append(errs, r.result)
+	}
+
+	return
+}
+
+// wait will wait for a replica to return, dropping the replica if it stalls and may be dropped
+func (f *fanoutWriter) wait(r *replicaStream, aborted bool) {
+	timer := time.NewTimer(f.stallTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			f.finish(r, r.err)
+			return
+		case <-f.ctx.Done():
+			f.drop(r, f.ctx.Err())
+			return
+		case <-timer.C:
+		}
+
+		idle := time.Since(time.Unix(0, r.lastRead.Load()))
+		if idle < f.stallTimeout {
+			// Replica has read recently, check again once it could have stalled
+			timer.Reset(f.stallTimeout - idle)
+			continue
+		}
+
+		if aborted || f.viable()-1 >= f.required {
+			f.drop(r, ErrReplicaStalled)
+			return
+		}
+
+		timer.Reset(f.stallTimeout)
+	}
+}
+
+// viable will return the number of replicas which have succeeded or are still running
+func (f *fanoutWriter) viable() (n int) {
+	for _, r := range f.replicas {
+		if !r.finished || r.result == nil {
+			n++
+		}
+	}
+
+	return
+}
+
+// finish will record the result of a replica which has returned
+func (f *fanoutWriter) finish(r *replicaStream, err error) {
+	// Replica will not read any further, close the stream so nothing more is sent
+	f.closeStream(r, err)
+	r.finished = true
+	r.result = err
+}
+
+// drop will cancel a replica without waiting for it to return
+func (f *fanoutWriter) drop(r *replicaStream, err error) {
+	f.closeStream(r, err)
+	r.cancel()
+	r.finished = true
+	r.result = err
+}
+
+// closeStream will close a replica's stream with the provided error, unless it has already been closed
+func (f *fanoutWriter) closeStream(r *replicaStream, err error) {
+	if r.closed {
+		return
+	}
+
+	// The error is set before closing the channel, so it is visible to the replica once the channel is closed
+	r.closeErr = err
+	close(r.chunks)
+	r.closed = true
+}
+
+// replicaStream is the stream of chunks written to a single replica
+type replicaStream struct {
+	// Chunks are sent by the fan-out writer and read by the replica
+	chunks chan []byte
+	// Closed once the replica has returned
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// Error returned by the replica, set before done is closed
+	err error
+	// Error the stream was closed with, set before chunks is closed
+	closeErr error
+	// Unix nano timestamp of the last read by the replica
+	lastRead atoms.Int64
+
+	// Unread remainder of the current chunk, owned by the replica
+	buf []byte
+
+	// State owned by the fan-out writer
+	closed   bool
+	finished bool
+	result   error
+}
+
+// Read will read the chunks passed to the replica
+func (r *replicaStream) Read(bs []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		chunk, ok := <-r.chunks
+		r.lastRead.Store(time.Now().UnixNano())
+		if !ok && r.closeErr != nil {
+			return 0, r.closeErr
+		} else if !ok {
+			return 0, io.EOF
+		}
+
+		r.buf = chunk
+	}
+
+	n = copy(bs, r.buf)
+	r.buf = r.buf[n:]
+	return
+}
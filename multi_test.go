@@ -0,0 +1,222 @@
+package snapshotter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+)
+
+func TestMultiBackend(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	local := backends.NewFile(filepath.Join(backendTestDir, "local"))
+	remote := &testOfflineBackend{Backend: backends.NewFile(filepath.Join(backendTestDir, "remote"))}
+
+	write := func(m *MultiBackend, key, value string) error {
+		return m.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte(value))
+			return
+		})
+	}
+
+	if _, err := NewMultiBackend(MultiOptions{Quorum: 3}, local, remote); err != ErrInvalidQuorum {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidQuorum, err)
+	}
+
+	all, err := NewMultiBackend(MultiOptions{Quorum: QuorumAll}, local, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both replicas receive the same stream
+	if err = write(all, "test.1.txt", "one"); err != nil {
+		t.Fatal(err)
+	}
+
+	testBackendValue(t, local, "test.1.txt", "one")
+	testBackendValue(t, remote, "test.1.txt", "one")
+
+	// A failed replica does not reach a quorum of all
+	remote.offline.Set(true)
+	err = write(all, "test.2.txt", "two")
+	rerr, ok := err.(*ReplicationError)
+	if !ok {
+		t.Fatalf("invalid error, expected a replication error and received %v", err)
+	}
+
+	// The failed replica is reported, the healthy replica may be aborted once quorum can no longer be reached
+	if failure := rerr.Failures[len(rerr.Failures)-1]; rerr.Succeeded > 1 || failure.Replica != 1 || failure.Err != errTestTransient {
+		t.Fatalf("invalid replication error, received %+v", rerr)
+	}
+
+	// A failed replica is reported, but still reaches a quorum of any
+	var any *MultiBackend
+	if any, err = NewMultiBackend(MultiOptions{Quorum: QuorumAny}, remote, local); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed []int
+	any.OnReplicaError(func(replica int, key string, err error) {
+		failed = append(failed, replica)
+	})
+
+	if err = write(any, "test.3.txt", "three"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0] != 0 {
+		t.Fatalf("invalid failed replicas, expected %v and received %v", []int{0}, failed)
+	}
+
+	// Reads fall back to the next replica when the first does not have the key
+	testBackendValue(t, any, "test.3.txt", "three")
+
+	var keys []string
+	if keys, err = any.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting a key which did not reach every replica succeeds
+	if err = all.Delete("test.3.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are listed from every replica
+	var listed int
+	for _, key := range keys {
+		if key == "test.1.txt" || key == "test.3.txt" {
+			listed++
+		}
+	}
+
+	if listed != 2 {
+		t.Fatalf("invalid keys, expected %v to be listed and received %v", []string{"test.1.txt", "test.3.txt"}, keys)
+	}
+}
+
+func TestMultiBackend_Lagging(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// The local replica is listed first, so it serves reads when it is up to date
+	local := &testOfflineBackend{Backend: backends.NewFile(filepath.Join(backendTestDir, "local"))}
+	remote := backends.NewFile(filepath.Join(backendTestDir, "remote"))
+
+	m, err := NewMultiBackend(MultiOptions{Quorum: QuorumAny}, local, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(value string) {
+		if err := m.WriteTo("test.latest.txt", func(w io.Writer) (err error) {
+			_, err = w.Write([]byte(value))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("one")
+	testBackendValue(t, m, "test.latest.txt", "one")
+
+	// The local replica misses a write while quorum is still reached
+	local.offline.Set(true)
+	write("two")
+
+	// Reads must not be served by the replica which missed the write
+	testBackendValue(t, m, "test.latest.txt", "two")
+
+	// Once the local replica receives a write, it is read from again
+	local.offline.Set(false)
+	write("three")
+	if lagging := m.getLagging("test.latest.txt"); lagging != nil {
+		t.Fatalf("invalid lagging replicas, expected none and received %v", lagging)
+	}
+
+	testBackendValue(t, m, "test.latest.txt", "three")
+}
+
+func TestMultiBackend_Stalled(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	local := backends.NewFile(backendTestDir)
+	// Stalled replica never reads and ignores cancellation, like a hung connection
+	stalled := &testStalledBackend{release: make(chan struct{})}
+	defer close(stalled.release)
+
+	m, err := NewMultiBackend(MultiOptions{Quorum: QuorumAny, BufferSize: 1024, StallTimeout: time.Millisecond * 50}, stalled, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed atoms.Int64
+	m.OnReplicaError(func(replica int, key string, err error) {
+		if replica == 0 && err == ErrReplicaStalled {
+			failed.Add(1)
+		}
+	})
+
+	// Large values fill the stalled replica's buffer, small values stall once written in full
+	large := bytes.Repeat([]byte("hello world "), 64*1024)
+	for _, value := range []string{string(large), "hello world"} {
+		done := make(chan error, 1)
+		go func() {
+			done <- m.WriteTo("test.txt", func(w io.Writer) (err error) {
+				_, err = w.Write([]byte(value))
+				return
+			})
+		}()
+
+		select {
+		case err = <-done:
+		case <-time.After(time.Second * 3):
+			t.Fatal("timed out waiting for write to complete")
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testBackendValue(t, local, "test.txt", value)
+	}
+
+	if n := failed.Load(); n != 2 {
+		t.Fatalf("invalid number of stalled replica reports, expected %d and received %d", 2, n)
+	}
+}
+
+// testStalledBackend is a back-end whose writes block until released
+type testStalledBackend struct {
+	Backend
+
+	release chan struct{}
+}
+
+// WriteTo will block until released without reading from the provided function
+func (s *testStalledBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	<-s.release
+	return errTestTransient
+}
+
+func testBackendValue(t *testing.T, be Backend, key, expected string) {
+	if err := be.ReadFrom(key, func(r io.Reader) (err error) {
+		var bs []byte
+		if bs, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+
+		if string(bs) != expected {
+			t.Fatalf("invalid value for \"%s\", expected \"%s\" and received \"%s\"", key, expected, string(bs))
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
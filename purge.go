@@ -0,0 +1,219 @@
+package snapshotter
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// purgePageSize is the number of keys requested per List call while purging
+const purgePageSize = 1000
+
+// PurgeReport is the outcome of a purge
+type PurgeReport struct {
+	// Deleted are the keys which were deleted
+	Deleted []string
+	// Skipped are the keys which matched our prefix but could not be parsed as our snapshots
+	Skipped []string
+	// Failed are the keys which could not be deleted
+	Failed []PurgeFailure
+	// BytesReclaimed is the total size of the deleted keys
+	// Note: This is only tracked for back-ends which implement Sizer
+	BytesReclaimed int64
+}
+
+// PurgeFailure is a key which could not be deleted
+type PurgeFailure struct {
+	Key string
+	Err error
+}
+
+// PurgePlan is the outcome of evaluating the retention policy without deleting anything
+type PurgePlan struct {
+	// Keep are the snapshots which would be kept
+	Keep []PlanEntry
+	// Delete are the snapshots which would be deleted
+	Delete []PlanEntry
+	// Skipped are the keys which matched our prefix but could not be parsed as our snapshots
+	Skipped []string
+}
+
+// PlanEntry is a snapshot within a purge plan
+type PlanEntry struct {
+	Key  string
+	Time time.Time
+	// Reasons explain why the snapshot would be kept or deleted
+	Reasons []string
+}
+
+// Sizer is an optional interface for back-ends which can report the size of a key
+type Sizer interface {
+	Size(key string) (int64, error)
+}
+
+// Purge will delete the snapshots which are not kept by the retention policy
+func (s *Snapshotter) Purge() (report PurgeReport, err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		err = errors.ErrIsClosed
+		return
+	}
+
+	return s.purge(s.work)
+}
+
+// PlanPurge will return the keys the current retention policy would keep and delete
+// Note: This does not delete anything from the back-end
+func (s *Snapshotter) PlanPurge() (plan PurgePlan, err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		err = errors.ErrIsClosed
+		return
+	}
+
+	ctx, cancel := withTimeout(s.work, s.cfg.PurgeTimeout)
+	defer cancel()
+	return s.plan(ctx)
+}
+
+// plan will evaluate the retention policy against the entire key space
+func (s *Snapshotter) plan(ctx context.Context) (plan PurgePlan, err error) {
+	var entries []snapshotEntry
+	if entries, plan.Skipped, err = s.listEntries(ctx); err != nil {
+		return
+	}
+
+	retention := s.cfg.getRetention()
+	// Iterate through the retention decisions
+	for _, decision := range retention.apply(entries, time.Now()) {
+		entry := PlanEntry{
+			Key:     decision.entry.key,
+			Time:    decision.entry.time,
+			Reasons: decision.reasons,
+		}
+
+		if decision.isKept() {
+			plan.Keep = append(plan.Keep, entry)
+			continue
+		}
+
+		entry.Reasons = []string{"not matched by retention policy"}
+		plan.Delete = append(plan.Delete, entry)
+	}
+
+	return
+}
+
+// purge will delete the entries which are not kept by the retention policy
+func (s *Snapshotter) purge(ctx context.Context) (report PurgeReport, err error) {
+	// Apply purge timeout (if set)
+	ctx, cancel := withTimeout(ctx, s.cfg.PurgeTimeout)
+	defer cancel()
+
+	var plan PurgePlan
+	if plan, err = s.plan(ctx); err != nil {
+		return
+	}
+
+	report.Skipped = plan.Skipped
+
+	if s.cfg.DryRun {
+		// Dry run is enabled, log our plan rather than deleting
+		s.logPurgePlan(plan)
+		return
+	}
+
+	for _, entry := range plan.Delete {
+		s.remove(ctx, entry.Key, &report)
+	}
+
+	return
+}
+
+// listEntries will walk the entire key space for our name and return the parsed snapshot entries
+// Keys which share our prefix but are not our snapshots are returned as skipped
+func (s *Snapshotter) listEntries(ctx context.Context) (entries []snapshotEntry, skipped []string, err error) {
+	var marker string
+	for {
+		var keys []string
+		if keys, err = list(ctx, s.be, s.codec.Prefix(s.cfg.Name), marker, purgePageSize); err != nil {
+			return
+		}
+
+		// Iterate through returned keys
+		for _, key := range keys {
+			if isSidecar(key) {
+				// Sidecars are removed alongside their snapshot, continue
+				continue
+			}
+
+			name, _, ts, perr := s.codec.Decode(key)
+			switch {
+			case perr == ErrIsLatestKey:
+			case perr != nil || name != s.cfg.Name:
+				// Key does not belong to us, skip
+				skipped = append(skipped, key)
+			default:
+				// Retention buckets are computed within the same location as our keys
+				entries = append(entries, snapshotEntry{key: key, time: ts.In(s.cfg.getLocation())})
+			}
+		}
+
+		if len(keys) < purgePageSize {
+			// We've reached the end of the key space, return
+			return
+		}
+
+		// Set marker as the last key we've seen
+		marker = keys[len(keys)-1]
+	}
+}
+
+// remove will delete a key and record the outcome within the provided report
+func (s *Snapshotter) remove(ctx context.Context, key string, report *PurgeReport) {
+	var size int64
+	if sizer, ok := s.be.(Sizer); ok {
+		// Get the size before deleting, a failure only affects our reclaimed byte count
+		size, _ = sizer.Size(key)
+	}
+
+	if err := deleteKey(ctx, s.be, key); err != nil {
+		report.Failed = append(report.Failed, PurgeFailure{Key: key, Err: err})
+		return
+	}
+
+	for _, suffix := range sidecarSuffixes {
+		// Snapshots made by older versions will not have sidecars, so errors are ignored
+		deleteKey(ctx, s.be, key+suffix)
+	}
+
+	report.Deleted = append(report.Deleted, key)
+	report.BytesReclaimed += size
+	s.hooks.emitPurge(key)
+}
+
+// logPurgeReport will log the skipped and failed keys of a purge
+func (s *Snapshotter) logPurgeReport(report PurgeReport) {
+	for _, key := range report.Skipped {
+		s.cfg.Logger.Warning("skipped unrecognized key while purging", Fields{"name": s.cfg.Name, "key": key})
+	}
+
+	for _, failure := range report.Failed {
+		s.cfg.Logger.Error("error deleting key while purging", Fields{"name": s.cfg.Name, "key": failure.Key, "error": failure.Err})
+	}
+}
+
+// logPurgePlan will log the entries of a purge plan
+func (s *Snapshotter) logPurgePlan(plan PurgePlan) {
+	for _, entry := range plan.Keep {
+		s.cfg.Logger.Info("dry run: would keep", Fields{"name": s.cfg.Name, "key": entry.Key, "reasons": strings.Join(entry.Reasons, ", ")})
+	}
+
+	for _, entry := range plan.Delete {
+		s.cfg.Logger.Info("dry run: would delete", Fields{"name": s.cfg.Name, "key": entry.Key, "reasons": strings.Join(entry.Reasons, ", ")})
+	}
+}
@@ -0,0 +1,128 @@
+package snapshotter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestSnapshotter_Purge(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	write := func(key string) {
+		if err := be.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Write more expired snapshots than a single List page can return
+	expired := time.Now().Add(-Year).Unix()
+	for i := 0; i < purgePageSize+5; i++ {
+		write(fmt.Sprintf("test.%d.txt", expired+int64(i)))
+	}
+
+	// Write a key which shares our prefix but cannot be parsed
+	write("test.foreign.object.txt")
+	// Write a key for a name which begins with our name, this is outside of our prefix
+	write("testing.123.txt")
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	cfg.Logger = defaultLogger
+
+	// Initialize a Snapshotter without background loops so our purge is the only one running
+	s := &Snapshotter{be: be, cfg: cfg, codec: DefaultKeyCodec}
+
+	var (
+		report PurgeReport
+		err    error
+	)
+
+	if report, err = s.purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Deleted) != purgePageSize+5 {
+		t.Fatalf("invalid number of deleted keys, expected %d and received %d", purgePageSize+5, len(report.Deleted))
+	}
+
+	if len(report.Skipped) != 1 {
+		t.Fatalf("invalid skipped keys, expected %d and received %v", 1, report.Skipped)
+	}
+
+	if len(report.Failed) != 0 {
+		t.Fatalf("invalid failed keys, expected none and received %v", report.Failed)
+	}
+
+	if expected := int64(len("hello world") * (purgePageSize + 5)); report.BytesReclaimed != expected {
+		t.Fatalf("invalid bytes reclaimed, expected %d and received %d", expected, report.BytesReclaimed)
+	}
+}
+
+func TestSnapshotter_PlanPurge(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	now := time.Now()
+	keys := []string{
+		fmt.Sprintf("test.%d.txt", now.Add(-Year).Unix()),
+		fmt.Sprintf("test.%d.txt", now.Add(-Day*2).Unix()),
+		fmt.Sprintf("test.%d.txt", now.Add(-Hour).Unix()),
+	}
+
+	for _, key := range keys {
+		if err := be.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	cfg.Logger = defaultLogger
+	cfg.TTL = Day
+
+	// Initialize a Snapshotter without background loops so our plan is the only one running
+	s := &Snapshotter{be: be, cfg: cfg, codec: DefaultKeyCodec}
+
+	var (
+		plan PurgePlan
+		err  error
+	)
+
+	if plan, err = s.plan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Keep) != 1 || plan.Keep[0].Key != keys[2] {
+		t.Fatalf("invalid kept keys, expected [%s] and received %+v", keys[2], plan.Keep)
+	}
+
+	if len(plan.Delete) != 2 {
+		t.Fatalf("invalid deleted keys, expected %d and received %+v", 2, plan.Delete)
+	}
+
+	var remaining []string
+	if remaining, err = be.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(remaining) != len(keys) {
+		t.Fatalf("invalid number of keys, expected %d and received %d", len(keys), len(remaining))
+	}
+}
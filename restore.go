@@ -0,0 +1,136 @@
+package snapshotter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrNotRestorer is returned when a restore is attempted with a front-end which does not implement Restorer
+const ErrNotRestorer = errors.Error("front-end does not support restoring")
+
+// Restorer is an optional interface for front-ends which can be restored from a snapshot
+type Restorer interface {
+	Restore(r io.Reader) error
+}
+
+// ContextRestorer is an optional interface for restorers which support cancellation
+type ContextRestorer interface {
+	Restorer
+
+	RestoreContext(ctx context.Context, r io.Reader) error
+}
+
+// restoreFrom will restore the front-end from the provided reader
+func restoreFrom(ctx context.Context, fe Frontend, r io.Reader) (err error) {
+	if crs, ok := fe.(ContextRestorer); ok {
+		return crs.RestoreContext(ctx, r)
+	}
+
+	rs, ok := fe.(Restorer)
+	if !ok {
+		return ErrNotRestorer
+	}
+
+	// Ensure our context hasn't been cancelled before calling the blocking method
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	return rs.Restore(r)
+}
+
+// Restore will restore the front-end from the snapshot stored at the provided key
+// Note: The snapshot is staged within a temporary file and verified (checksum and signature)
+// before the front-end is restored, a corrupted or tampered snapshot never reaches the front-end
+func (s *Snapshotter) Restore(key string) (err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		return errors.ErrIsClosed
+	}
+
+	// Acquire mutex lock so snapshots cannot run during the restore
+	s.mu.Lock()
+	// Defer releasing of the mutex lock
+	defer s.mu.Unlock()
+	return s.restore(s.work, key)
+}
+
+// RestoreLatest will restore the front-end from the latest snapshot
+func (s *Snapshotter) RestoreLatest() (err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		return errors.ErrIsClosed
+	}
+
+	// Acquire mutex lock so snapshots cannot run during the restore
+	s.mu.Lock()
+	// Defer releasing of the mutex lock
+	defer s.mu.Unlock()
+
+	var key string
+	if key, err = s.getLatest(s.work); err != nil {
+		return
+	}
+
+	return s.restore(s.work, key)
+}
+
+// RestoreAt will restore the front-end from the most recent snapshot taken at or before the provided
+// time and return it's key. No background loops are started, so nothing is snapshotted or purged while
+// restoring and there is nothing to close afterwards
+func RestoreAt(ctx context.Context, fe Frontend, be Backend, cfg Config, t time.Time) (key string, err error) {
+	// Validate the inbound configuration
+	if err = cfg.Validate(); err != nil {
+		return
+	}
+
+	var s Snapshotter
+	s.fe = fe
+	s.be = be
+	s.cfg = cfg
+	s.codec = cfg.getKeyCodec()
+
+	if key, err = s.keyAt(ctx, t); err != nil {
+		return
+	}
+
+	err = s.restore(ctx, key)
+	return
+}
+
+func (s *Snapshotter) restore(ctx context.Context, key string) (err error) {
+	// Ensure our front-end supports restoring before reading from the back-end
+	if _, ok := s.fe.(Restorer); !ok {
+		return ErrNotRestorer
+	}
+
+	// Stage the snapshot within a temporary file, readers from decorated back-ends cannot seek
+	// so the snapshot can only be verified once it has been read in full
+	var f *os.File
+	if f, err = ioutil.TempFile("", "snapshotter-restore-"); err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = s.load(ctx, key, func(r io.Reader) (err error) {
+		_, err = io.Copy(f, r)
+		return
+	}); err != nil {
+		// Snapshot could not be read or did not pass verification, return
+		return
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	return restoreFrom(ctx, s.fe, f)
+}
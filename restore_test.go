@@ -0,0 +1,243 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/gdbu/snapshotter/frontends"
+)
+
+func TestSnapshotter_Restore(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	fe := &testRestoreFrontend{}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RestoreLatest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if str := fe.restored.String(); str != "hello world" {
+		t.Fatalf("invalid restored value, expected \"%s\" and received \"%s\"", "hello world", str)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	fe.restored.Reset()
+	if err = s.Restore(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	if str := fe.restored.String(); str != "hello world" {
+		t.Fatalf("invalid restored value, expected \"%s\" and received \"%s\"", "hello world", str)
+	}
+}
+
+func TestRestoreAt(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	fe := &testRestoreFrontend{}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+
+	// Write snapshots an hour apart
+	now := time.Now().Truncate(Hour)
+	codec := cfg.getKeyCodec()
+	for i, value := range []string{"hello world", "hello w0rld"} {
+		value := value
+		if err := be.WriteTo(codec.Encode("test", "txt", now.Add(Hour*time.Duration(i))), func(w io.Writer) (err error) {
+			_, err = w.Write([]byte(value))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Snapshots without a manifest are treated as taken at the end of their truncation window, the
+	// second snapshot may have been taken after the requested time
+	key, err := RestoreAt(context.Background(), fe, be, cfg, now.Add(Hour+Minute*30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := codec.Encode("test", "txt", now); key != expected {
+		t.Fatalf("invalid key, expected \"%s\" and received \"%s\"", expected, key)
+	}
+
+	if str := fe.restored.String(); str != "hello world" {
+		t.Fatalf("invalid restored value, expected \"%s\" and received \"%s\"", "hello world", str)
+	}
+
+	if _, err = RestoreAt(context.Background(), fe, be, cfg, now.Add(Minute*30)); err != ErrSnapshotNotFound {
+		t.Fatalf("invalid error, expected %v and received %v", ErrSnapshotNotFound, err)
+	}
+}
+
+func TestSnapshotter_RestoreUnsupported(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RestoreLatest(); err != ErrNotRestorer {
+		t.Fatalf("invalid error, expected %v and received %v", ErrNotRestorer, err)
+	}
+}
+
+func TestSnapshotter_RestoreCorrupted(t *testing.T) {
+	var (
+		s   *Snapshotter
+		db  *bolt.DB
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+
+	var dir string
+	if dir, err = ioutil.TempDir("", "snapshotter-restore-test-"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if db, err = bolt.Open(filepath.Join(dir, "bolt.db"), 0644, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(value string) {
+		if err := db.Update(func(txn *bolt.Tx) (err error) {
+			var bkt *bolt.Bucket
+			if bkt, err = txn.CreateBucketIfNotExists([]byte("test")); err != nil {
+				return
+			}
+
+			return bkt.Put([]byte("key"), []byte(value))
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put("1")
+	fe := frontends.NewBolt(db)
+	fe.SetRestoreOptions(frontends.BoltRestoreOptions{Swap: true})
+	defer func() { fe.DB().Close() }()
+
+	// Compressed back-ends pass a reader which cannot seek to the restore
+	var cbe *CompressedBackend
+	if cbe, err = NewCompressedBackend(backends.NewFile(backendTestDir), CodecGzip, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "db")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(fe, cbe, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var key string
+	if key, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the snapshot with a valid database which does not match the manifest checksum
+	put("2")
+	if err = cbe.WriteTo(key, fe.Copy); err != nil {
+		t.Fatal(err)
+	}
+
+	put("3")
+	if err = s.Restore(key); err == nil {
+		t.Fatal("expected an error restoring a corrupted snapshot and received nil")
+	} else if _, ok := err.(*ErrChecksumMismatch); !ok {
+		t.Fatalf("invalid error, expected a checksum mismatch and received %v", err)
+	}
+
+	// Ensure the live database was not replaced
+	if err = fe.DB().View(func(txn *bolt.Tx) (err error) {
+		if value := string(txn.Bucket([]byte("test")).Get([]byte("key"))); value != "3" {
+			t.Fatalf("invalid live value, expected \"%s\" and received \"%s\"", "3", value)
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "bolt.db.restore")); !os.IsNotExist(err) {
+		t.Fatalf("expected the restored database to not exist, received %v", err)
+	}
+}
+
+// testRestoreFrontend is a front-end which records the snapshot it was restored from
+type testRestoreFrontend struct {
+	testFrontend
+
+	restored bytes.Buffer
+}
+
+// Restore will restore from an io.Reader
+func (f *testRestoreFrontend) Restore(r io.Reader) (err error) {
+	_, err = io.Copy(&f.restored, r)
+	return
+}
@@ -0,0 +1,180 @@
+package snapshotter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrInvalidRetention is returned when a retention policy has negative values
+	ErrInvalidRetention = errors.Error("invalid retention policy, values cannot be negative")
+)
+
+// NewTTLPolicy will return a RetentionPolicy which keeps all snapshots newer than the provided TTL
+// Note: A TTL of zero or less will return an empty policy, which keeps all snapshots
+func NewTTLPolicy(ttl time.Duration) (r RetentionPolicy) {
+	if ttl <= 0 {
+		return
+	}
+
+	r.KeepWithin = ttl
+	return
+}
+
+// RetentionPolicy determines which snapshots are kept during a purge. Each tier is evaluated
+// independently and a snapshot is kept when at least one tier keeps it. The periodic tiers
+// keep the newest snapshot within each of the N most recent periods which contain a snapshot
+// Note: An empty policy keeps all snapshots
+type RetentionPolicy struct {
+	// KeepLast keeps the N most recent snapshots
+	KeepLast int
+	// KeepHourly keeps the newest snapshot for each of the N most recent hours
+	KeepHourly int
+	// KeepDaily keeps the newest snapshot for each of the N most recent days
+	KeepDaily int
+	// KeepWeekly keeps the newest snapshot for each of the N most recent ISO weeks
+	KeepWeekly int
+	// KeepMonthly keeps the newest snapshot for each of the N most recent months
+	KeepMonthly int
+	// KeepYearly keeps the newest snapshot for each of the N most recent years
+	KeepYearly int
+	// KeepWithin keeps all snapshots newer than the duration
+	KeepWithin time.Duration
+}
+
+// IsZero will return whether or not the policy is empty
+func (r *RetentionPolicy) IsZero() bool {
+	return *r == RetentionPolicy{}
+}
+
+// Validate will validate a RetentionPolicy
+func (r *RetentionPolicy) Validate() (err error) {
+	switch {
+	case r.KeepLast < 0:
+	case r.KeepHourly < 0:
+	case r.KeepDaily < 0:
+	case r.KeepWeekly < 0:
+	case r.KeepMonthly < 0:
+	case r.KeepYearly < 0:
+	case r.KeepWithin < 0:
+	default:
+		return
+	}
+
+	return ErrInvalidRetention
+}
+
+// apply will evaluate the policy against the provided snapshots
+func (r *RetentionPolicy) apply(entries []snapshotEntry, now time.Time) (decisions []retentionDecision) {
+	decisions = make([]retentionDecision, len(entries))
+	for i, entry := range entries {
+		decisions[i].entry = entry
+	}
+
+	// Sort decisions from newest to oldest
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[j].entry.before(decisions[i].entry)
+	})
+
+	if r.IsZero() {
+		// Empty policies keep everything
+		for i := range decisions {
+			decisions[i].keep("no retention policy")
+		}
+
+		return
+	}
+
+	for i := range decisions {
+		if i < r.KeepLast {
+			decisions[i].keep(fmt.Sprintf("last %d", r.KeepLast))
+		}
+
+		if r.KeepWithin > 0 && decisions[i].entry.time.After(now.Add(-r.KeepWithin)) {
+			decisions[i].keep(fmt.Sprintf("within %v", r.KeepWithin))
+		}
+	}
+
+	applyTier(decisions, "hourly", r.KeepHourly, hourBucket)
+	applyTier(decisions, "daily", r.KeepDaily, dayBucket)
+	applyTier(decisions, "weekly", r.KeepWeekly, weekBucket)
+	applyTier(decisions, "monthly", r.KeepMonthly, monthBucket)
+	applyTier(decisions, "yearly", r.KeepYearly, yearBucket)
+	return
+}
+
+// applyTier keeps the newest snapshot within each of the n most recent buckets
+// Note: Decisions are expected to be sorted from newest to oldest
+func applyTier(decisions []retentionDecision, name string, n int, bucket func(time.Time) string) {
+	var last string
+	for i := range decisions {
+		if n <= 0 {
+			return
+		}
+
+		current := bucket(decisions[i].entry.time)
+		if current == last {
+			// We've already kept a snapshot for this bucket, continue
+			continue
+		}
+
+		decisions[i].keep(fmt.Sprintf("%s %s", name, current))
+		last = current
+		n--
+	}
+}
+
+func hourBucket(t time.Time) string {
+	return t.Format("2006-01-02T15")
+}
+
+func dayBucket(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func weekBucket(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week)
+}
+
+func monthBucket(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+func yearBucket(t time.Time) string {
+	return t.Format("2006")
+}
+
+// snapshotEntry is a snapshot key and it's parsed timestamp
+type snapshotEntry struct {
+	key  string
+	time time.Time
+}
+
+// before will determine if the entry was taken before the provided entry
+// Note: Entries sharing a truncated time are ordered by key, which orders sequenced keys
+func (s snapshotEntry) before(entry snapshotEntry) bool {
+	if s.time.Equal(entry.time) {
+		return s.key < entry.key
+	}
+
+	return s.time.Before(entry.time)
+}
+
+// retentionDecision is the outcome of a retention policy for a single snapshot
+type retentionDecision struct {
+	entry snapshotEntry
+	// Reasons the snapshot is being kept, snapshots without reasons are removed
+	reasons []string
+}
+
+func (r *retentionDecision) keep(reason string) {
+	r.reasons = append(r.reasons, reason)
+}
+
+func (r *retentionDecision) isKept() bool {
+	return len(r.reasons) > 0
+}
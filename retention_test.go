@@ -0,0 +1,45 @@
+package snapshotter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2026, time.October, 17, 12, 30, 0, 0, time.UTC)
+
+	var entries []snapshotEntry
+	// Create an hourly snapshot for the last three days
+	for i := 0; i < 72; i++ {
+		ts := now.Add(-time.Duration(i) * time.Hour).Truncate(time.Hour)
+		entries = append(entries, snapshotEntry{key: fmt.Sprintf("test.%d.db", ts.Unix()), time: ts})
+	}
+
+	tests := []struct {
+		policy   RetentionPolicy
+		expected int
+	}{
+		{policy: RetentionPolicy{}, expected: 72},
+		{policy: RetentionPolicy{KeepLast: 5}, expected: 5},
+		{policy: RetentionPolicy{KeepHourly: 3}, expected: 3},
+		// Three most recent hours plus the newest snapshot of the two days prior to today
+		{policy: RetentionPolicy{KeepHourly: 3, KeepDaily: 3}, expected: 5},
+		{policy: RetentionPolicy{KeepWithin: 6 * time.Hour}, expected: 6},
+		{policy: RetentionPolicy{KeepMonthly: 2, KeepYearly: 2}, expected: 1},
+		{policy: NewTTLPolicy(24 * time.Hour), expected: 24},
+	}
+
+	for _, test := range tests {
+		var kept int
+		for _, decision := range test.policy.apply(entries, now) {
+			if decision.isKept() {
+				kept++
+			}
+		}
+
+		if kept != test.expected {
+			t.Fatalf("invalid number of kept snapshots for %+v, expected %d and received %d", test.policy, test.expected, kept)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package snapshotter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrInvalidRetryPolicy is returned when a retry policy has negative values
+const ErrInvalidRetryPolicy = errors.Error("invalid retry policy, attempts and backoff durations cannot be negative")
+
+// RetryPolicy determines how failed operations are retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// Note: A value of one or less will not retry
+	MaxAttempts int
+	// BaseBackoff is the wait before the first retry, the wait doubles with each retry
+	BaseBackoff time.Duration
+	// MaxBackoff is the maximum wait between attempts
+	// Note: A value of zero will not limit the wait
+	MaxBackoff time.Duration
+	// Jitter is the maximum random delay added to each wait
+	Jitter time.Duration
+	// Retryable determines whether or not an error should be retried
+	// Note: When nil, IsRetryable is used
+	Retryable func(error) bool
+}
+
+// RetryFn is called before an operation is retried
+type RetryFn func(attempt int, err error, wait time.Duration)
+
+// Validate will validate a RetryPolicy
+func (r *RetryPolicy) Validate() (err error) {
+	if r.MaxAttempts < 0 || r.BaseBackoff < 0 || r.MaxBackoff < 0 || r.Jitter < 0 {
+		return ErrInvalidRetryPolicy
+	}
+
+	return
+}
+
+// do will call the provided function until it succeeds, returns a non-retryable error,
+// the maximum number of attempts has been reached or the context is done
+func (r *RetryPolicy) do(ctx context.Context, fn func() error, onRetry RetryFn) (err error) {
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return
+		}
+
+		if attempt >= r.MaxAttempts || !r.isRetryable(err) || ctx.Err() != nil {
+			return
+		}
+
+		wait := r.backoff(attempt)
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff will return the wait following the provided attempt
+func (r *RetryPolicy) backoff(attempt int) (wait time.Duration) {
+	wait = r.BaseBackoff
+	for i := 1; i < attempt; i++ {
+		if r.MaxBackoff > 0 && wait >= r.MaxBackoff {
+			break
+		}
+
+		if wait > math.MaxInt64/2 {
+			// Doubling would overflow, return the largest wait
+			break
+		}
+
+		wait *= 2
+	}
+
+	if r.MaxBackoff > 0 && wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+
+	return wait + getJitter(r.Jitter)
+}
+
+func (r *RetryPolicy) isRetryable(err error) bool {
+	if r.Retryable == nil {
+		return IsRetryable(err)
+	}
+
+	return r.Retryable(err)
+}
+
+// IsRetryable is the default retryable error classifier. Only errors known to be transient are retried, these
+// are errors reporting an HTTP status code (such as S3 request failures) of 429 or 5xx, errors reporting they
+// are a timeout or temporary (such as network errors), reset, refused or aborted connections, broken pipes,
+// unexpected EOFs and replication errors where a failed replica encountered one of the above
+// Note: All other errors (e.g. authentication failures, ErrInvalidKey or ErrSpoolFull) are not retried,
+// RetryPolicy.Retryable may be set to retry additional errors
+func IsRetryable(err error) bool {
+	for err != nil {
+		switch err {
+		case context.Canceled, context.DeadlineExceeded:
+			return false
+		case io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE:
+			return true
+		}
+
+		switch e := err.(type) {
+		case interface{ StatusCode() int }:
+			code := e.StatusCode()
+			return code == 429 || code >= 500
+		case *ReplicationError:
+			for _, failure := range e.Failures {
+				if IsRetryable(failure.Err) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
+			return true
+		}
+
+		if t, ok := err.(interface{ Temporary() bool }); ok && t.Temporary() {
+			return true
+		}
+
+		// Check the error this error wraps (if any)
+		err = unwrapError(err)
+	}
+
+	return false
+}
+
+// unwrapError will return the error wrapped by the provided error, or nil if it does not wrap an error
+func unwrapError(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ OrigErr() error }:
+		// AWS errors expose the error they wrap through OrigErr
+		return e.OrigErr()
+
+	default:
+		return nil
+	}
+}
+
+// NewRetryingBackend returns a back-end decorator which retries failed calls according to the provided policy
+func NewRetryingBackend(be Backend, policy RetryPolicy) (rp *RetryingBackend, err error) {
+	if err = policy.Validate(); err != nil {
+		return
+	}
+
+	var r RetryingBackend
+	r.be = be
+	r.policy = policy
+	rp = &r
+	return
+}
+
+// RetryingBackend is a back-end decorator which retries failed calls
+// Note: The functions passed to WriteTo and ReadFrom are only called once. Writes are buffered to a
+// temporary file before being retried and reads are buffered to a temporary file before being passed on.
+// Values are buffered as they are passed to this back-end, so a RetryingBackend must be decorated by any
+// encryption layer (e.g. NewEncryptedBackend(retrying, key)) to avoid buffering plaintext snapshots
+type RetryingBackend struct {
+	be     Backend
+	policy RetryPolicy
+}
+
+// WriteTo will pass a writer to the provided function
+func (r *RetryingBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return r.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will pass a writer to the provided function, the buffered value is written to the
+// underlying back-end (with retries) once the function has returned
+func (r *RetryingBackend) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	var f *os.File
+	if f, err = newRetryBuffer(); err != nil {
+		return
+	}
+	defer closeRetryBuffer(f)
+
+	if err = fn(f); err != nil {
+		return
+	}
+
+	return r.policy.do(ctx, func() (err error) {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		return writeTo(ctx, r.be, key, func(w io.Writer) (err error) {
+			_, err = io.Copy(w, f)
+			return
+		})
+	}, nil)
+}
+
+// ReadFrom will pass a reader to the provided function
+func (r *RetryingBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return r.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will read the value from the underlying back-end (with retries) and
+// pass the buffered value to the provided function
+func (r *RetryingBackend) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	var f *os.File
+	if f, err = newRetryBuffer(); err != nil {
+		return
+	}
+	defer closeRetryBuffer(f)
+
+	if err = r.policy.do(ctx, func() (err error) {
+		// Discard anything written by a previous attempt
+		if err = f.Truncate(0); err != nil {
+			return
+		}
+
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		return readFrom(ctx, r.be, key, func(rdr io.Reader) (err error) {
+			_, err = io.Copy(f, rdr)
+			return
+		})
+	}, nil); err != nil {
+		return
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	return fn(f)
+}
+
+// Delete will delete a key
+func (r *RetryingBackend) Delete(key string) (err error) {
+	return r.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will delete a key
+func (r *RetryingBackend) DeleteContext(ctx context.Context, key string) (err error) {
+	return r.policy.do(ctx, func() error {
+		return deleteKey(ctx, r.be, key)
+	}, nil)
+}
+
+// List will list the available keys
+func (r *RetryingBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return r.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the available keys
+func (r *RetryingBackend) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	err = r.policy.do(ctx, func() (err error) {
+		keys, err = list(ctx, r.be, prefix, marker, maxKeys)
+		return
+	}, nil)
+
+	return
+}
+
+// Next will return the next key
+func (r *RetryingBackend) Next(prefix, marker string) (nextKey string, err error) {
+	return r.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key
+func (r *RetryingBackend) NextContext(ctx context.Context, prefix, marker string) (nextKey string, err error) {
+	err = r.policy.do(ctx, func() (err error) {
+		nextKey, err = next(ctx, r.be, prefix, marker)
+		return
+	}, nil)
+
+	return
+}
+
+// Unwrap will return the underlying back-end
+func (r *RetryingBackend) Unwrap() Backend {
+	return r.be
+}
+
+// newRetryBuffer will create a temporary file used to buffer values between attempts
+func newRetryBuffer() (*os.File, error) {
+	return ioutil.TempFile("", "snapshotter-retry-")
+}
+
+// closeRetryBuffer will close and remove a temporary buffer file
+func closeRetryBuffer(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
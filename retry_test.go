@@ -0,0 +1,248 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+	"github.com/hatchify/errors"
+)
+
+// errTestTransient is a temporary error, it is retried by the default retry policy
+const errTestTransient = testTemporaryError("transient failure")
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	r := RetryPolicy{BaseBackoff: Second, MaxBackoff: Second * 5}
+	expected := []time.Duration{Second, Second * 2, Second * 4, Second * 5, Second * 5}
+	for i, wait := range expected {
+		if backoff := r.backoff(i + 1); backoff != wait {
+			t.Fatalf("invalid backoff for attempt %d, expected %v and received %v", i+1, wait, backoff)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: context.Canceled, expected: false},
+		{err: context.DeadlineExceeded, expected: false},
+		{err: io.EOF, expected: false},
+		{err: os.ErrNotExist, expected: false},
+		{err: ErrInvalidKey, expected: false},
+		{err: ErrSpoolFull, expected: false},
+		{err: errors.Error("password authentication failed for user \"postgres\""), expected: false},
+		{err: testStatusError(403), expected: false},
+		{err: testStatusError(429), expected: true},
+		{err: testStatusError(503), expected: true},
+		{err: errTestTransient, expected: true},
+		{err: io.ErrUnexpectedEOF, expected: true},
+		{err: &os.SyscallError{Syscall: "write", Err: syscall.ECONNRESET}, expected: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, expected: true},
+		{err: &ReplicationError{Failures: []ReplicaError{{Err: ErrInvalidKey}}}, expected: false},
+		{err: &ReplicationError{Failures: []ReplicaError{{Err: ErrInvalidKey}, {Replica: 1, Err: errTestTransient}}}, expected: true},
+	}
+
+	for _, test := range tests {
+		if retryable := IsRetryable(test.err); retryable != test.expected {
+			t.Fatalf("invalid retryable value for %v, expected %v and received %v", test.err, test.expected, retryable)
+		}
+	}
+}
+
+func TestSnapshotter_Retry(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	fe := &testFlakyFrontend{failures: 2}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+	cfg.Retry = RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+
+	if s, err = New(fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := fe.count.Load(); count != 3 {
+		t.Fatalf("invalid number of attempts, expected %d and received %d", 3, count)
+	}
+
+	// Non-retryable errors should not be retried
+	fe.count.Store(0)
+	fe.failures = 2
+	s.cfg.Retry.Retryable = func(err error) bool { return err != errTestTransient }
+	if err = s.Snapshot(); err != errTestTransient {
+		t.Fatalf("invalid error, expected %v and received %v", errTestTransient, err)
+	}
+
+	if count := fe.count.Load(); count != 1 {
+		t.Fatalf("invalid number of attempts, expected %d and received %d", 1, count)
+	}
+}
+
+func TestRetryingBackend(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend which fails the first two calls of each operation
+	be := &testFlakyBackend{Backend: backends.NewFile(backendTestDir), failures: 2}
+
+	rb, err := NewRetryingBackend(be, RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	if err = rb.WriteToContext(context.Background(), "test.txt", func(w io.Writer) (err error) {
+		calls++
+		_, err = w.Write([]byte("hello world"))
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("invalid number of write function calls, expected %d and received %d", 1, calls)
+	}
+
+	be.failures = 2
+	calls = 0
+	if err = rb.ReadFrom("test.txt", func(r io.Reader) (err error) {
+		calls++
+		var bs []byte
+		if bs, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+
+		if string(bs) != "hello world" {
+			t.Fatalf("invalid value, expected \"%s\" and received \"%s\"", "hello world", string(bs))
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("invalid number of read function calls, expected %d and received %d", 1, calls)
+	}
+
+	// Missing keys should not be retried
+	be.failures = 0
+	if err = rb.ReadFrom("missing.txt", func(io.Reader) error { return nil }); !os.IsNotExist(err) {
+		t.Fatalf("invalid error, expected not exist and received %v", err)
+	}
+
+	if attempts := be.attempts.Load(); attempts != 7 {
+		t.Fatalf("invalid number of back-end calls, expected %d and received %d", 7, attempts)
+	}
+}
+
+// testFlakyFrontend is a front-end which fails a number of copies before succeeding
+type testFlakyFrontend struct {
+	count    atoms.Int64
+	failures int64
+}
+
+// Copy will copy to an io.Writer
+func (f *testFlakyFrontend) Copy(w io.Writer) (err error) {
+	if f.count.Add(1) <= f.failures {
+		return errTestTransient
+	}
+
+	_, err = w.Write([]byte("hello world"))
+	return
+}
+
+// testFlakyBackend is a back-end which fails a number of writes and reads before succeeding
+type testFlakyBackend struct {
+	Backend
+
+	attempts atoms.Int64
+	failures int
+}
+
+// WriteTo will pass a writer to the provided function
+func (f *testFlakyBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	f.attempts.Add(1)
+	if f.failures > 0 {
+		f.failures--
+		// Write partially before failing
+		return f.Backend.WriteTo(key, func(w io.Writer) (err error) {
+			w.Write([]byte("hello"))
+			return errTestTransient
+		})
+	}
+
+	return f.Backend.WriteTo(key, fn)
+}
+
+// ReadFrom will pass a reader to the provided function
+func (f *testFlakyBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	f.attempts.Add(1)
+	if f.failures > 0 {
+		f.failures--
+		// Read partially before failing
+		return f.Backend.ReadFrom(key, func(r io.Reader) (err error) {
+			buf := make([]byte, 5)
+			if _, err = io.ReadFull(r, buf); err != nil {
+				return
+			}
+
+			fn(bytes.NewReader(buf))
+			return errTestTransient
+		})
+	}
+
+	return f.Backend.ReadFrom(key, fn)
+}
+
+// testTemporaryError is an error which reports itself as temporary
+type testTemporaryError string
+
+// Error will return the error message
+func (e testTemporaryError) Error() string {
+	return string(e)
+}
+
+// Temporary will return true, the error is always temporary
+func (e testTemporaryError) Temporary() bool {
+	return true
+}
+
+// testStatusError is an error which reports an HTTP status code
+type testStatusError int
+
+// Error will return the error message
+func (e testStatusError) Error() string {
+	return "request failed with status " + strconv.Itoa(int(e))
+}
+
+// StatusCode will return the HTTP status code
+func (e testStatusError) StatusCode() int {
+	return int(e)
+}
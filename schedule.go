@@ -0,0 +1,271 @@
+package snapshotter
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrInvalidSchedule is returned when a schedule expression cannot be parsed
+	ErrInvalidSchedule = errors.Error("invalid schedule, must be a 5 or 6 field cron expression")
+)
+
+// Schedule determines when snapshots occur
+type Schedule interface {
+	// Next returns the next activation time after the provided time
+	Next(t time.Time) time.Time
+}
+
+// newIntervalSchedule will return a schedule which activates once per interval
+func newIntervalSchedule(interval time.Duration) *intervalSchedule {
+	var i intervalSchedule
+	i.interval = interval
+	return &i
+}
+
+// intervalSchedule activates once per interval, relative to the previous activation
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Next returns the next activation time after the provided time
+func (i *intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(i.interval)
+}
+
+// ParseSchedule will parse a standard cron expression. Both the 5 field format
+// (minute, hour, day of month, month, day of week) and the 6 field format with a
+// leading seconds field are supported, as are the @yearly, @monthly, @weekly,
+// @daily and @hourly descriptors
+// Note: Expressions are evaluated in the location of the time passed to Next. Wall-clock times
+// skipped by a daylight saving transition do not run, and repeated times run at each occurrence
+func ParseSchedule(expr string) (sp Schedule, err error) {
+	if descriptor, ok := descriptors[expr]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		// Prepend seconds field so that snapshots occur at the top of the minute
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		err = ErrInvalidSchedule
+		return
+	}
+
+	var c cronSchedule
+	if c.second, err = parseField(fields[0], 0, 59); err != nil {
+		return
+	}
+
+	if c.minute, err = parseField(fields[1], 0, 59); err != nil {
+		return
+	}
+
+	if c.hour, err = parseField(fields[2], 0, 23); err != nil {
+		return
+	}
+
+	if c.dom, err = parseField(fields[3], 1, 31); err != nil {
+		return
+	}
+
+	if c.month, err = parseField(fields[4], 1, 12); err != nil {
+		return
+	}
+
+	if c.dow, err = parseField(fields[5], 0, 7); err != nil {
+		return
+	}
+
+	// Sunday may be represented as either 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domAny = isWildcard(fields[3])
+	c.dowAny = isWildcard(fields[5])
+	sp = &c
+	return
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSchedule activates on the times matched by a cron expression
+type cronSchedule struct {
+	second uint64
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// Whether or not the day of month and day of week fields are wildcards
+	domAny bool
+	dowAny bool
+}
+
+// Next returns the next activation time after the provided time
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	// Start at the next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	// Cron expressions which can never match (e.g. February 30th) will give up after five years
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+
+		if !c.matchDay(t) {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+
+		if !has(c.hour, t.Hour()) {
+			t = nextHour(t)
+			continue
+		}
+
+		if !has(c.minute, t.Minute()) {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+
+		if !has(c.second, t.Second()) {
+			t = t.Add(time.Second)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// advance will return the provided next time, unless it does not follow the provided time
+// (such as a midnight skipped by a daylight saving transition), then the next hour is returned
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+
+	return nextHour(t)
+}
+
+// nextHour will return the start of the hour following the provided time
+// Note: This is calculated from elapsed time rather than the wall clock, as wall-clock
+// hours may be skipped or repeated by daylight saving transitions
+func nextHour(t time.Time) time.Time {
+	return t.Add(time.Duration(60-t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+}
+
+// matchDay follows cron semantics, when both day fields are restricted a day matching either is accepted
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := has(c.dom, t.Day())
+	dowMatch := has(c.dow, int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// parseField will parse a comma separated cron field into a bit set
+func parseField(field string, min, max int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		var partBits uint64
+		if partBits, err = parseRange(part, min, max); err != nil {
+			return
+		}
+
+		bits |= partBits
+	}
+
+	return
+}
+
+// parseRange will parse a single cron range (e.g. "*", "5", "1-5", "*/15" or "10-40/10") into a bit set
+func parseRange(part string, min, max int) (bits uint64, err error) {
+	var (
+		start = min
+		end   = max
+		step  = 1
+	)
+
+	rangePart := part
+	if i := strings.IndexByte(part, '/'); i != -1 {
+		rangePart = part[:i]
+		if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+			return 0, fmt.Errorf("%v: invalid step \"%s\"", ErrInvalidSchedule, part)
+		}
+	}
+
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.IndexByte(rangePart, '-') != -1:
+		bounds := strings.SplitN(rangePart, "-", 2)
+		if start, err = strconv.Atoi(bounds[0]); err != nil {
+			return 0, fmt.Errorf("%v: invalid range \"%s\"", ErrInvalidSchedule, part)
+		}
+
+		if end, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, fmt.Errorf("%v: invalid range \"%s\"", ErrInvalidSchedule, part)
+		}
+
+	default:
+		if start, err = strconv.Atoi(rangePart); err != nil {
+			return 0, fmt.Errorf("%v: invalid value \"%s\"", ErrInvalidSchedule, part)
+		}
+
+		if rangePart != part {
+			// A single value with a step (e.g. "5/15") runs from the value to the maximum
+			end = max
+		} else {
+			end = start
+		}
+	}
+
+	if start < min || end > max || start > end {
+		return 0, fmt.Errorf("%v: \"%s\" is outside of the range %d-%d", ErrInvalidSchedule, part, min, max)
+	}
+
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+
+	return
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func has(bits uint64, n int) bool {
+	return bits&(1<<uint(n)) != 0
+}
+
+// getJitter will return a random duration within [0, max)
+func getJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
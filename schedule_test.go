@@ -0,0 +1,269 @@
+package snapshotter
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2026, time.October, 17, 13, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: "* * * * *", expected: time.Date(2026, time.October, 17, 13, 8, 0, 0, time.UTC)},
+		{expr: "0 */6 * * *", expected: time.Date(2026, time.October, 17, 18, 0, 0, 0, time.UTC)},
+		{expr: "30 2 * * *", expected: time.Date(2026, time.October, 18, 2, 30, 0, 0, time.UTC)},
+		{expr: "0 0 1 * *", expected: time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 9 * * 1-5", expected: time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", expected: time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)},
+		{expr: "*/15 * * * * *", expected: time.Date(2026, time.October, 17, 13, 7, 45, 0, time.UTC)},
+		{expr: "0 0 29 2 *", expected: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "@hourly", expected: time.Date(2026, time.October, 17, 14, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSchedule(test.expr)
+		if err != nil {
+			t.Fatalf("error parsing \"%s\": %v", test.expr, err)
+		}
+
+		if next := s.Next(start); !next.Equal(test.expected) {
+			t.Fatalf("invalid next time for \"%s\", expected %v and received %v", test.expr, test.expected, next)
+		}
+	}
+
+	for _, expr := range []string{"", "* * *", "60 * * * *", "* * * 13 *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Fatalf("expected error parsing \"%s\"", expr)
+		}
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		start    time.Time
+		expected []time.Time
+	}{
+		{
+			name:     "year rollover",
+			expr:     "0 0 * * *",
+			start:    time.Date(2026, time.December, 31, 23, 59, 30, 0, time.UTC),
+			expected: []time.Time{time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "month rollover",
+			expr:     "0 12 * * *",
+			start:    time.Date(2026, time.January, 31, 12, 0, 0, 0, time.UTC),
+			expected: []time.Time{time.Date(2026, time.February, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "day of month skips short months",
+			expr:  "0 0 31 * *",
+			start: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2026, time.May, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, time.July, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "non-leap february",
+			expr:     "0 0 * * *",
+			start:    time.Date(2027, time.February, 28, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{time.Date(2027, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "day of week across months",
+			expr:     "0 9 * * 1",
+			start:    time.Date(2026, time.October, 31, 9, 0, 0, 0, time.UTC),
+			expected: []time.Time{time.Date(2026, time.November, 2, 9, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "daylight saving skips a nonexistent time",
+			expr:  "30 2 * * *",
+			start: time.Date(2026, time.March, 7, 12, 0, 0, 0, ny),
+			expected: []time.Time{
+				time.Date(2026, time.March, 9, 2, 30, 0, 0, ny),
+				time.Date(2026, time.March, 10, 2, 30, 0, 0, ny),
+			},
+		},
+		{
+			name:  "daylight saving hourly across the skipped hour",
+			expr:  "0 * * * *",
+			start: time.Date(2026, time.March, 8, 1, 30, 0, 0, ny),
+			expected: []time.Time{
+				time.Date(2026, time.March, 8, 3, 0, 0, 0, ny),
+				time.Date(2026, time.March, 8, 4, 0, 0, 0, ny),
+			},
+		},
+		{
+			name:  "daylight saving runs a repeated time at each occurrence",
+			expr:  "30 1 * * *",
+			start: time.Date(2026, time.November, 1, 0, 0, 0, 0, ny),
+			expected: []time.Time{
+				time.Date(2026, time.November, 1, 5, 30, 0, 0, time.UTC),
+				time.Date(2026, time.November, 1, 6, 30, 0, 0, time.UTC),
+				time.Date(2026, time.November, 2, 1, 30, 0, 0, ny),
+			},
+		},
+		{
+			name:  "daylight saving hourly across the repeated hour",
+			expr:  "0 * * * *",
+			start: time.Date(2026, time.November, 1, 0, 30, 0, 0, ny),
+			expected: []time.Time{
+				time.Date(2026, time.November, 1, 5, 0, 0, 0, time.UTC),
+				time.Date(2026, time.November, 1, 6, 0, 0, 0, time.UTC),
+				time.Date(2026, time.November, 1, 7, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSchedule(test.expr)
+		if err != nil {
+			t.Fatalf("%s: error parsing \"%s\": %v", test.name, test.expr, err)
+		}
+
+		next := test.start
+		for _, expected := range test.expected {
+			if next = s.Next(next); !next.Equal(expected) {
+				t.Fatalf("%s: invalid next time for \"%s\", expected %v and received %v", test.name, test.expr, expected, next)
+			}
+		}
+	}
+}
+
+func TestSnapshotter_NextRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		expr   string
+		jitter time.Duration
+	}{
+		{name: "cron", expr: "0 * * * *"},
+		{name: "cron with jitter", expr: "0 * * * *", jitter: time.Minute},
+		{name: "seconds with jitter", expr: "*/15 * * * * *", jitter: time.Second * 10},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.expr)
+		if err != nil {
+			t.Fatalf("%s: error parsing \"%s\": %v", test.name, test.expr, err)
+		}
+
+		cfg := NewConfig("test", "txt")
+		cfg.Jitter = test.jitter
+		// Initialize a Snapshotter without background loops
+		s := &Snapshotter{cfg: cfg, schedule: schedule}
+		if next := s.NextRun(); !next.IsZero() {
+			t.Fatalf("%s: expected a zero next run before scheduling and received %v", test.name, next)
+		}
+
+		before := schedule.Next(time.Now())
+		timer := s.newScheduleTimer()
+		timer.Stop()
+		after := schedule.Next(time.Now())
+
+		// The scheduled time may roll over while scheduling, accept either activation
+		next := s.NextRun()
+		if next.Before(before) || !next.Before(after.Add(test.jitter+time.Nanosecond)) {
+			t.Fatalf("%s: invalid next run, expected within [%v, %v] and received %v", test.name, before, after.Add(test.jitter), next)
+		}
+	}
+}
+
+func TestSnapshotter_ScheduleLocation(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	schedule, err := ParseSchedule("0 0 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Use a location which is not the local time zone of the host
+	offset := int((Hour*5 + Minute*30).Seconds())
+	if _, local := time.Now().Zone(); local == offset {
+		offset = -offset
+	}
+
+	loc := time.FixedZone("test", offset)
+
+	cfg := NewConfig("test", "txt")
+	cfg.Location = loc
+	// Initialize a Snapshotter without background loops
+	s := &Snapshotter{be: be, cfg: cfg, codec: DefaultKeyCodec, schedule: schedule}
+
+	now := time.Now().In(loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	timer := s.newScheduleTimer()
+	timer.Stop()
+
+	// The next run is midnight within our location, the day may roll over while scheduling
+	if next := s.NextRun(); !next.Equal(midnight.AddDate(0, 0, 1)) && !next.Equal(midnight.AddDate(0, 0, 2)) {
+		t.Fatalf("invalid next run, expected %v and received %v", midnight.AddDate(0, 0, 1), next.In(loc))
+	}
+
+	tests := []struct {
+		last     time.Time
+		expected bool
+	}{
+		{last: midnight.Add(-Minute), expected: true},
+		{last: midnight.Add(Minute), expected: false},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		key := DefaultKeyCodec.Encode("test", "txt", test.last)
+		if err = s.setManifest(ctx, Manifest{Key: key, End: test.last}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = s.setLatest(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+
+		if overdue := s.isOverdue(ctx, time.Now()); overdue != test.expected {
+			t.Fatalf("invalid overdue value for a snapshot completed at %v, expected %v and received %v", test.last, test.expected, overdue)
+		}
+	}
+}
+
+func TestGetJitter(t *testing.T) {
+	tests := []struct {
+		max time.Duration
+	}{
+		{max: -time.Second},
+		{max: 0},
+		{max: 1},
+		{max: time.Millisecond},
+		{max: time.Hour},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 1000; i++ {
+			jitter := getJitter(test.max)
+			if test.max <= 0 && jitter != 0 {
+				t.Fatalf("invalid jitter for %v, expected zero and received %v", test.max, jitter)
+			}
+
+			if test.max > 0 && (jitter < 0 || jitter >= test.max) {
+				t.Fatalf("invalid jitter for %v, expected within [0, %v) and received %v", test.max, test.max, jitter)
+			}
+		}
+	}
+}
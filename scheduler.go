@@ -0,0 +1,200 @@
+package snapshotter
+
+import (
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrInvalidOverrunPolicy is returned when an invalid overrun policy is set
+const ErrInvalidOverrunPolicy = errors.Error("invalid overrun policy, must select OverrunSkip or OverrunQueue")
+
+// OverrunPolicy determines what occurs when a scheduled snapshot is due while the previous snapshot is still running
+type OverrunPolicy uint8
+
+const (
+	// OverrunSkip will skip the scheduled snapshot
+	OverrunSkip OverrunPolicy = iota
+	// OverrunQueue will run the scheduled snapshot once the running snapshot has completed
+	// Note: At most one scheduled snapshot is queued, further overruns are coalesced into it
+	OverrunQueue
+)
+
+// Validate will validate an OverrunPolicy
+func (o OverrunPolicy) Validate() (err error) {
+	switch o {
+	case OverrunSkip, OverrunQueue:
+		return
+	default:
+		return ErrInvalidOverrunPolicy
+	}
+}
+
+// ScheduleDecision describes how the scheduler handled a snapshot which was requested while a snapshot was running
+type ScheduleDecision uint8
+
+const (
+	// DecisionSkipped is reported when a scheduled snapshot was skipped due to OverrunSkip
+	DecisionSkipped ScheduleDecision = iota
+	// DecisionQueued is reported when a scheduled snapshot was queued due to OverrunQueue
+	DecisionQueued
+	// DecisionCoalesced is reported when a request was merged into an already pending snapshot
+	DecisionCoalesced
+)
+
+// String will return the name of the decision
+func (d ScheduleDecision) String() string {
+	switch d {
+	case DecisionSkipped:
+		return "skipped"
+	case DecisionQueued:
+		return "queued"
+	case DecisionCoalesced:
+		return "coalesced"
+
+	default:
+		return "invalid"
+	}
+}
+
+// snapshotLoop is the scheduler, it owns all snapshot execution until the lifecycle context is done.
+// Scheduled and manual snapshots are never run concurrently, requests which arrive while a snapshot
+// is running are coalesced into a single snapshot which begins once the running snapshot has completed
+func (s *Snapshotter) snapshotLoop() {
+	// Notify the wait group once the loop has exited
+	defer s.wg.Done()
+
+	var (
+		// Result of the running snapshot
+		done = make(chan error, 1)
+		// Whether or not a snapshot is running
+		running bool
+		// Whether or not the running snapshot was triggered by the schedule
+		scheduled bool
+		// Requests waiting on the running snapshot
+		waiting []chan error
+		// Requests waiting on the next snapshot
+		pending []chan error
+		// Whether or not a scheduled snapshot is queued behind the running snapshot
+		queued bool
+	)
+
+	start := func(isScheduled bool, requests []chan error) {
+		running = true
+		scheduled = isScheduled
+		waiting = requests
+		go func() {
+			// Acquire mutex lock so snapshots cannot run during a restore
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			done <- s.snapshot(s.work)
+		}()
+	}
+
+	finish := func(err error) {
+		if err != nil && scheduled {
+			s.cfg.Logger.Error("error encountered snapshotting", Fields{"name": s.cfg.Name, "error": err})
+		}
+
+		respond(waiting, err)
+		running = false
+		waiting = nil
+	}
+
+	timer := s.newStartupTimer()
+	// Timer is replaced on each tick, so the stop is deferred within a closure
+	defer func() { timer.Stop() }()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			// Service is closing, wait for the running snapshot to complete
+			if running {
+				finish(<-done)
+			}
+
+			respond(pending, errors.ErrIsClosed)
+			return
+
+		case <-timer.C:
+			requested := time.Now()
+			timer = s.newScheduleTimer()
+			if s.paused.Get() {
+				// Snapshots have been paused, wait for the next scheduled time
+				continue
+			}
+
+			if !running {
+				start(true, nil)
+				continue
+			}
+
+			switch {
+			case s.cfg.OverrunPolicy == OverrunSkip:
+				s.reportDecision(DecisionSkipped, requested)
+			case queued || len(pending) > 0:
+				// A snapshot is already pending, this tick will be satisfied by it
+				queued = true
+				s.reportDecision(DecisionCoalesced, requested)
+			default:
+				queued = true
+				s.reportDecision(DecisionQueued, requested)
+			}
+
+		case request := <-s.requests:
+			if !running {
+				start(false, []chan error{request})
+				continue
+			}
+
+			if queued || len(pending) > 0 {
+				// A snapshot is already pending, this request will be satisfied by it
+				s.reportDecision(DecisionCoalesced, time.Now())
+			}
+
+			pending = append(pending, request)
+
+		case err := <-done:
+			finish(err)
+			if !queued && len(pending) == 0 {
+				continue
+			}
+
+			start(queued, pending)
+			queued = false
+			pending = nil
+		}
+	}
+}
+
+// newScheduleTimer will return a timer which fires at the next scheduled time
+// Note: If the schedule will never activate, the returned timer never fires
+func (s *Snapshotter) newScheduleTimer() (timer *time.Timer) {
+	// Get the next scheduled time, schedules are evaluated within our configured location
+	next := s.schedule.Next(time.Now().In(s.cfg.getLocation()))
+	if next.IsZero() {
+		// Schedule will never activate, manual snapshots are still served
+		s.cfg.Logger.Error("schedule has no upcoming activations", Fields{"name": s.cfg.Name, "schedule": s.cfg.Schedule})
+		timer = time.NewTimer(time.Hour)
+		timer.Stop()
+		return
+	}
+
+	// Apply jitter to the scheduled time
+	next = next.Add(getJitter(s.cfg.Jitter))
+	s.nextRun.Store(next.UnixNano())
+	return time.NewTimer(time.Until(next))
+}
+
+// reportDecision will log and emit a scheduling decision
+func (s *Snapshotter) reportDecision(decision ScheduleDecision, requested time.Time) {
+	s.cfg.Logger.Info("snapshot "+decision.String()+", previous snapshot is still running", Fields{"name": s.cfg.Name})
+	s.hooks.emitSchedule(decision, requested)
+}
+
+// respond will send the provided result to each of the requests
+func respond(requests []chan error, err error) {
+	for _, request := range requests {
+		request <- err
+	}
+}
@@ -0,0 +1,197 @@
+package snapshotter
+
+import (
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+)
+
+func TestSnapshotter_CoalesceRequests(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	fe := newTestGatedFrontend()
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshots will run
+	cfg.Interval = Hour
+
+	if s, err = New(fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		// Allow the front-end to pass through the closing snapshot
+		fe.passthrough.Set(true)
+		s.Close()
+	}()
+
+	var coalesced atoms.Int64
+	s.OnSchedule(func(decision ScheduleDecision, _ time.Time) {
+		if decision == DecisionCoalesced {
+			coalesced.Add(1)
+		}
+	})
+
+	var wg sync.WaitGroup
+	snapshot := func() {
+		defer wg.Done()
+		if err := s.Snapshot(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Begin our first snapshot and wait for it to reach the front-end
+	wg.Add(1)
+	go snapshot()
+	<-fe.started
+
+	// Request more snapshots while the first is running
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go snapshot()
+	}
+
+	// Wait for the requests to be coalesced
+	waitFor(t, func() bool { return coalesced.Load() == 2 })
+
+	// Release the running snapshot, followed by the coalesced snapshot
+	fe.release <- struct{}{}
+	<-fe.started
+	fe.release <- struct{}{}
+	wg.Wait()
+
+	if count := fe.count.Load(); count != 2 {
+		t.Fatalf("invalid number of copies, expected %d and received %d", 2, count)
+	}
+}
+
+func TestSnapshotter_OverrunPolicy(t *testing.T) {
+	tcs := []struct {
+		policy   OverrunPolicy
+		decision ScheduleDecision
+		copies   int64
+	}{
+		{policy: OverrunSkip, decision: DecisionSkipped, copies: 1},
+		{policy: OverrunQueue, decision: DecisionQueued, copies: 2},
+	}
+
+	for _, tc := range tcs {
+		testOverrunPolicy(t, tc.policy, tc.decision, tc.copies)
+	}
+}
+
+func testOverrunPolicy(t *testing.T, policy OverrunPolicy, expected ScheduleDecision, copies int64) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	fe := newTestGatedFrontend()
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to one second so our first snapshot overruns the next tick
+	cfg.Interval = Second
+	cfg.OverrunPolicy = policy
+
+	if s, err = New(fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	decisions := make(chan ScheduleDecision, 8)
+	s.OnSchedule(func(decision ScheduleDecision, _ time.Time) {
+		decisions <- decision
+	})
+
+	// Wait for the first scheduled snapshot to reach the front-end
+	<-fe.started
+
+	select {
+	case decision := <-decisions:
+		if decision != expected {
+			t.Fatalf("invalid decision, expected %s and received %s", expected, decision)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timed out waiting for a scheduling decision")
+	}
+
+	// Pause so no further scheduled snapshots begin
+	s.Pause()
+	fe.release <- struct{}{}
+
+	if policy == OverrunQueue {
+		// Release the queued snapshot
+		<-fe.started
+		fe.release <- struct{}{}
+	}
+
+	// Allow the front-end to pass through the closing snapshot
+	fe.passthrough.Set(true)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing snapshot is included within the number of copies
+	if count := fe.count.Load(); count != copies+1 {
+		t.Fatalf("invalid number of copies for %v, expected %d and received %d", policy, copies+1, count)
+	}
+}
+
+// waitFor will wait up to three seconds for the provided condition to be met
+func waitFor(t *testing.T, fn func() bool) {
+	deadline := time.Now().Add(time.Second * 3)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// newTestGatedFrontend will return a new front-end which blocks each copy until released
+func newTestGatedFrontend() *testGatedFrontend {
+	var f testGatedFrontend
+	f.started = make(chan struct{})
+	f.release = make(chan struct{})
+	return &f
+}
+
+// testGatedFrontend is a front-end which blocks each copy until released
+type testGatedFrontend struct {
+	count atoms.Int64
+	// Copies are not blocked once passthrough is set
+	passthrough atoms.Bool
+
+	started chan struct{}
+	release chan struct{}
+}
+
+// Copy will copy to an io.Writer
+func (f *testGatedFrontend) Copy(w io.Writer) (err error) {
+	f.count.Add(1)
+	if !f.passthrough.Get() {
+		f.started <- struct{}{}
+		<-f.release
+	}
+
+	_, err = w.Write([]byte("hello world"))
+	return
+}
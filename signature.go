@@ -0,0 +1,202 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/hatchify/errors"
+)
+
+const (
+	// ErrMissingSignature is returned when trusted keys are configured and a snapshot has no signature
+	ErrMissingSignature = errors.Error("snapshot signature is missing")
+	// ErrInvalidSignature is returned when a snapshot signature was not made by a trusted key
+	ErrInvalidSignature = errors.Error("snapshot signature is invalid or was not made by a trusted key")
+	// ErrInvalidSigningKey is returned when a signing key cannot be decoded
+	ErrInvalidSigningKey = errors.Error("invalid signing key, must be a 32 byte seed or 64 byte private key (raw, hex or base64 encoded)")
+	// ErrInvalidPublicKey is returned when a public key cannot be decoded
+	ErrInvalidPublicKey = errors.Error("invalid public key, must be 32 bytes (raw, hex or base64 encoded)")
+)
+
+const (
+	// signatureSuffix is appended to a snapshot key to form the key of it's signature
+	signatureSuffix = ".sig"
+	// signatureContext is prepended to the signed message
+	signatureContext = "snapshotter signature v2\n"
+)
+
+// Signature is a detached Ed25519 signature of a snapshot
+// Note: The signature covers the key, compression and checksum of the snapshot, so a signed
+// snapshot copied under another key (along with it's signature) fails verification
+type Signature struct {
+	// PublicKey is the base64 encoded public key of the signer
+	PublicKey string `json:"publicKey"`
+	// Key is the key the snapshot was written under
+	Key string `json:"key"`
+	// Compression is the compression applied to the snapshot by the front-end (if any)
+	Compression string `json:"compression,omitempty"`
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot, as written by the front-end
+	SHA256 string `json:"sha256"`
+	// Signature is the base64 encoded signature of the signed message
+	Signature string `json:"signature"`
+}
+
+// newSignature will sign the provided key, compression and hex encoded checksum
+func newSignature(private ed25519.PrivateKey, key, compression, checksum string) (sig Signature) {
+	sig.PublicKey = base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey))
+	sig.Key = key
+	sig.Compression = compression
+	sig.SHA256 = checksum
+	sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, sig.message()))
+	return
+}
+
+// verify will ensure the signature was made for the provided key by one of the trusted keys
+func (s *Signature) verify(key string, trusted []ed25519.PublicKey) (err error) {
+	if s.Key != key {
+		// Signature was made for another snapshot
+		return ErrInvalidSignature
+	}
+
+	var (
+		publicKey []byte
+		signature []byte
+	)
+
+	if publicKey, err = base64.StdEncoding.DecodeString(s.PublicKey); err != nil {
+		return ErrInvalidSignature
+	}
+
+	if signature, err = base64.StdEncoding.DecodeString(s.Signature); err != nil {
+		return ErrInvalidSignature
+	}
+
+	for _, trustedKey := range trusted {
+		if !bytes.Equal(trustedKey, publicKey) {
+			continue
+		}
+
+		if ed25519.Verify(trustedKey, s.message(), signature) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// message will return the canonical message which is signed
+// Note: The key and compression are quoted so their boundaries are unambiguous
+func (s *Signature) message() []byte {
+	return []byte(signatureContext + strconv.Quote(s.Key) + "\n" + strconv.Quote(s.Compression) + "\n" + s.SHA256)
+}
+
+// VerifySnapshot will ensure the snapshot stored at the provided key was signed by one of the trusted
+// keys and that it's contents match the signed checksum
+// Note: The back-end should include any decorators used when the snapshot was written (e.g. encryption)
+func VerifySnapshot(ctx context.Context, be Backend, key string, trusted []ed25519.PublicKey) (err error) {
+	var sig Signature
+	if sig, err = getSignature(ctx, be, key); err != nil {
+		return
+	}
+
+	if err = sig.verify(key, trusted); err != nil {
+		return
+	}
+
+	return readFrom(ctx, be, key, func(r io.Reader) (err error) {
+		hash := sha256.New()
+		if _, err = io.Copy(hash, r); err != nil {
+			return
+		}
+
+		return compareChecksum(key, sig.SHA256, hash.Sum(nil))
+	})
+}
+
+// LoadSigningKey will load an Ed25519 signing key from the provided file
+// Note: The key may be a 32 byte seed or a 64 byte private key, stored raw, hex encoded or base64 encoded
+func LoadSigningKey(filename string) (key ed25519.PrivateKey, err error) {
+	var bs []byte
+	if bs, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	switch bs = decodeKeyBytes(bs, ed25519.SeedSize, ed25519.PrivateKeySize); len(bs) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(bs), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(bs), nil
+
+	default:
+		return nil, ErrInvalidSigningKey
+	}
+}
+
+// LoadPublicKey will load an Ed25519 public key from the provided file
+// Note: The key may be stored raw, hex encoded or base64 encoded
+func LoadPublicKey(filename string) (key ed25519.PublicKey, err error) {
+	var bs []byte
+	if bs, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	if bs = decodeKeyBytes(bs, ed25519.PublicKeySize); len(bs) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return ed25519.PublicKey(bs), nil
+}
+
+// decodeKeyBytes will decode raw, hex or base64 encoded key bytes matching one of the provided sizes
+// Note: A nil slice is returned if the bytes cannot be decoded
+func decodeKeyBytes(bs []byte, sizes ...int) []byte {
+	matches := func(bs []byte) bool {
+		for _, size := range sizes {
+			if len(bs) == size {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if matches(bs) {
+		return bs
+	}
+
+	str := strings.TrimSpace(string(bs))
+	if decoded, err := hex.DecodeString(str); err == nil && matches(decoded) {
+		return decoded
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(str); err == nil && matches(decoded) {
+		return decoded
+	}
+
+	return nil
+}
+
+func getSignature(ctx context.Context, be Backend, key string) (sig Signature, err error) {
+	if err = readFrom(ctx, be, key+signatureSuffix, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&sig)
+	}); err != nil {
+		err = ErrMissingSignature
+	}
+
+	return
+}
+
+func setSignature(ctx context.Context, be Backend, key string, sig Signature) (err error) {
+	return writeTo(ctx, be, key+signatureSuffix, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(sig)
+	})
+}
@@ -0,0 +1,139 @@
+package snapshotter
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+)
+
+func TestSnapshotter_Signature(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	var (
+		public  ed25519.PublicKey
+		private ed25519.PrivateKey
+	)
+
+	if public, private, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+	cfg.SigningKey = private
+	cfg.TrustedKeys = []ed25519.PublicKey{public}
+
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Load(latest, confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = VerifySnapshot(context.Background(), be, latest, cfg.TrustedKeys); err != nil {
+		t.Fatal(err)
+	}
+
+	var untrusted ed25519.PublicKey
+	if untrusted, _, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = VerifySnapshot(context.Background(), be, latest, []ed25519.PublicKey{untrusted}); err != ErrInvalidSignature {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidSignature, err)
+	}
+
+	// Copy the signed snapshot (along with it's sidecars) under a newer key
+	copied := s.codec.Encode(cfg.Name, cfg.Extension, time.Now().Add(Hour))
+	for _, suffix := range append([]string{""}, sidecarSuffixes...) {
+		var bs []byte
+		if bs, err = ioutil.ReadFile(path.Join(backendTestDir, latest+suffix)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(backendTestDir, copied+suffix), bs, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.Load(copied, confirmHelloWorld); err != ErrInvalidSignature {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidSignature, err)
+	}
+
+	if err = VerifySnapshot(context.Background(), be, copied, cfg.TrustedKeys); err != ErrInvalidSignature {
+		t.Fatalf("invalid error, expected %v and received %v", ErrInvalidSignature, err)
+	}
+
+	// Tamper with the manifest compression, the signed compression is used instead
+	var m Manifest
+	if m, err = s.Stat(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Compression = string(CodecGzip)
+	if err = s.setManifest(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Load(latest, confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tamper with the stored snapshot and it's manifest checksum
+	if err = ioutil.WriteFile(path.Join(backendTestDir, latest), []byte("hello w0rld"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Remove(path.Join(backendTestDir, latest+manifestSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	discard := func(r io.Reader) (err error) {
+		_, err = io.Copy(ioutil.Discard, r)
+		return
+	}
+
+	if err = s.Load(latest, discard); err == nil {
+		t.Fatal("expected checksum mismatch and received nil")
+	} else if _, ok := err.(*ErrChecksumMismatch); !ok {
+		t.Fatalf("invalid error, expected checksum mismatch and received %v", err)
+	}
+
+	// Remove the signature
+	if err = os.Remove(path.Join(backendTestDir, latest+signatureSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Load(latest, discard); err != ErrMissingSignature {
+		t.Fatalf("invalid error, expected %v and received %v", ErrMissingSignature, err)
+	}
+}
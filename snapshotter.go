@@ -2,7 +2,9 @@ package snapshotter
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"sync"
 	"time"
@@ -13,7 +15,7 @@ import (
 
 const (
 	// ErrInvalidTruncate is returned when an invalid truncate duration is set
-	ErrInvalidTruncate = errors.Error("invalid truncate duration, must select time.Hour, time.Minute, or time.Second")
+	ErrInvalidTruncate = errors.Error("invalid truncate duration, must select Year, Month, Week, Day, Hour, Minute, or Second")
 	// ErrInvalidInterval is returned when an invalid interval duration is set
 	ErrInvalidInterval = errors.Error("invalid interval duration, must be greater than or equal to one second")
 	// ErrInvalidName is returned when an invalid name is set
@@ -24,29 +26,99 @@ const (
 	ErrInvalidKey = errors.Error("provided key has an invalid number of delimiters, cannot parse")
 	// ErrIsLatestKey is returned when a latest key is attempted to be parsed
 	ErrIsLatestKey = errors.Error("cannot parse latest key")
+	// ErrCloseTimeout is returned when the background loops do not exit before the close timeout
+	ErrCloseTimeout = errors.Error("timed out waiting for background loops to exit")
+	// ErrAlreadyStarted is returned when starting a Snapshotter whose background loops have already been started
+	ErrAlreadyStarted = errors.Error("snapshotter has already been started")
 )
 
 // New returns a new instance of snapshotter
 func New(fe Frontend, be Backend, cfg Config) (sp *Snapshotter, err error) {
+	return NewWithContext(context.Background(), fe, be, cfg)
+}
+
+// NewWithContext returns a new instance of snapshotter whose background loops
+// will stop when the provided context is cancelled or when the Snapshotter is closed
+func NewWithContext(ctx context.Context, fe Frontend, be Backend, cfg Config) (sp *Snapshotter, err error) {
+	return newSnapshotter(ctx, fe, be, cfg, nil)
+}
+
+// NewUnstarted returns a new instance of snapshotter whose background loops have not been started, so
+// hooks can be registered before any events (such as a catch-up snapshot) are emitted
+// Note: Start must be called to begin the background loops, manual snapshots wait until then
+func NewUnstarted(ctx context.Context, fe Frontend, be Backend, cfg Config) (sp *Snapshotter, err error) {
+	return initSnapshotter(ctx, fe, be, cfg, nil)
+}
+
+// newSnapshotter returns a new instance of snapshotter whose snapshots are limited by the provided semaphore
+// Note: A nil semaphore will not limit snapshots
+func newSnapshotter(ctx context.Context, fe Frontend, be Backend, cfg Config, sem semaphore) (sp *Snapshotter, err error) {
+	if sp, err = initSnapshotter(ctx, fe, be, cfg, sem); err != nil {
+		return
+	}
+
+	sp.start()
+	return
+}
+
+// initSnapshotter returns a new instance of snapshotter whose background loops have not been started
+// Note: This allows hooks to be registered before any events can be emitted, start must be called
+func initSnapshotter(ctx context.Context, fe Frontend, be Backend, cfg Config, sem semaphore) (sp *Snapshotter, err error) {
 	var s Snapshotter
 	// Validate the inbound configuration
 	if err = cfg.Validate(); err != nil {
 		return
 	}
 
+	// Get the snapshot schedule from our configuration
+	if s.schedule, err = cfg.getSchedule(); err != nil {
+		return
+	}
+
 	s.fe = fe
 	s.be = be
 	s.cfg = cfg
+	s.codec = cfg.getKeyCodec()
+	s.sem = sem
+	s.requests = make(chan chan error)
+	// Set default logger if one was not provided
+	if s.cfg.Logger == nil {
+		s.cfg.Logger = defaultLogger
+	}
+
+	// Create lifecycle context, this is cancelled on Close
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	// Create work context, this is cancelled when the close timeout has elapsed
+	s.work, s.halt = context.WithCancel(context.Background())
 
-	// Begin snapshot loop
-	go s.snapshotLoop(s.cfg.Interval)
-	// Begin purge loop
-	go s.purgeLoop(Hour)
 	// Assign snapshotter pointer as a reference to our snapshotter struct
 	sp = &s
 	return
 }
 
+// start will begin the background loops, ok is false if they have already been started
+func (s *Snapshotter) start() (ok bool) {
+	if !s.started.Set(true) {
+		// Background loops have already been started, return
+		return
+	}
+
+	// Increment wait group for both of our loops
+	s.wg.Add(2)
+	// Begin snapshot loop
+	go s.snapshotLoop()
+	// Begin purge loop
+	go s.purgeLoop(Hour)
+
+	if s.cfg.ScrubInterval > 0 {
+		// Increment wait group and begin scrub loop
+		s.wg.Add(1)
+		go s.scrubLoop(s.cfg.ScrubInterval)
+	}
+
+	return true
+}
+
 // Snapshotter will manage a snapshotting service
 type Snapshotter struct {
 	mu sync.RWMutex
@@ -55,103 +127,178 @@ type Snapshotter struct {
 	be  Backend
 	cfg Config
 
+	// Codec used to encode and decode snapshot keys
+	codec KeyCodec
+	// Semaphore shared with other snapshotters to limit concurrent snapshots (optional)
+	sem semaphore
+	// Schedule which determines when snapshots occur
+	schedule Schedule
+	// Unix nano timestamp of the next scheduled snapshot
+	nextRun atoms.Int64
+
+	// Lifecycle context and it's associated cancel func
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Work context and it's associated cancel func, in-flight operations utilize this context
+	work context.Context
+	halt context.CancelFunc
+	// Wait group for the background loops
+	wg sync.WaitGroup
+
+	// Snapshot requests sent to the scheduler, each request receives the result of the snapshot which satisfied it
+	requests chan chan error
+
+	// Registered event hooks
+	hooks hooks
+
+	// Started state, the background loops are started once
+	started atoms.Bool
+	// Paused state, scheduled snapshots are skipped while paused
+	paused atoms.Bool
 	// Closed state
 	closed atoms.Bool
 }
 
-// snapshotLoop will continuously snapshot on a provided interval (in seconds)
-func (s *Snapshotter) snapshotLoop(interval time.Duration) {
-	var err error
-	// Run loop as long as our service hasn't closed
-	for err != errors.ErrIsClosed {
-		// We sleep first because we want to wait for the interval duration before snapshotting.
-		time.Sleep(interval)
+// purgeLoop will continuously purge on a provided interval until the lifecycle context is done
+func (s *Snapshotter) purgeLoop(interval time.Duration) {
+	// Notify the wait group once the loop has exited
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		// Attempt to snapshot
-		if err = s.snapshot(); err != nil {
-			fmt.Printf("Error encountered snapshotting: %v\n", err)
+	for {
+		// We purge before waiting so we can ensure we are purged on start
+		report, err := s.purge(s.work)
+		if err != nil {
+			s.cfg.Logger.Error("error encountered purging", Fields{"name": s.cfg.Name, "error": err})
 		}
-	}
 
-	return
-}
+		s.logPurgeReport(report)
 
-// purgeLoop will continuously purge  on a provided interval (in seconds)
-func (s *Snapshotter) purgeLoop(interval time.Duration) {
-	var err error
-	// Run loop as long as our service hasn't closed
-	for err != errors.ErrIsClosed {
-		// Attempt to purge
-		if err = s.purge(); err != nil {
-			fmt.Printf("Error encountered purging: %v\n", err)
+		select {
+		case <-s.ctx.Done():
+			// Service is closing, return
+			return
+		case <-ticker.C:
 		}
-
-		// We sleep after purging so we can ensure we are purged on start
-		time.Sleep(interval)
 	}
-
-	return
 }
 
-// snapshot will write to our back-end from our front-end
-func (s *Snapshotter) snapshot() (err error) {
-	// Get new key
-	key := getKey(s.cfg.Name, s.cfg.Extension, s.cfg.Truncate)
+// wait will wait for the background loops to exit. If the timeout is greater than zero and
+// elapses before the loops have exited, ErrCloseTimeout is returned
+func (s *Snapshotter) wait(timeout time.Duration) (err error) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	if timeout <= 0 {
+		// No deadline has been set, wait indefinitely
+		<-done
+		return
+	}
 
-	// Attempt to write to our Writee
-	if err = s.be.WriteTo(key, s.fe.Copy); err != nil {
-		// Error encountered while writing, return
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
 		return
+	case <-timer.C:
+		return ErrCloseTimeout
 	}
+}
 
-	// Set our latest key value
-	return s.setLatest(key)
+// snapshot will write to our back-end from our front-end, retrying failed attempts according to our retry policy
+func (s *Snapshotter) snapshot(ctx context.Context) (err error) {
+	// Attempt to snapshot according to our retry policy
+	return s.cfg.Retry.do(ctx, func() error {
+		return s.attempt(ctx)
+	}, func(attempt int, err error, wait time.Duration) {
+		s.cfg.Logger.Warning("snapshot attempt failed, retrying", Fields{"name": s.cfg.Name, "attempt": attempt, "wait": wait, "error": err})
+	})
 }
 
-// purge delete entries older than the TTL
-func (s *Snapshotter) purge() (err error) {
-	var keys []string
-	if keys, err = s.be.List(s.cfg.Name, "", 1000); err != nil {
+// attempt will make a single attempt to write to our back-end from our front-end
+func (s *Snapshotter) attempt(ctx context.Context) (err error) {
+	// Wait for our turn to snapshot, this occurs before the timeout so waiting does not count against it
+	if err = s.sem.acquire(ctx); err != nil {
+		// No key has been chosen yet, so the error is emitted without one
+		s.hooks.emitSnapshotError("", err)
 		return
 	}
+	defer s.sem.release()
 
-	// Get cutoff timestamp
-	cutoff := time.Now().Add(-s.cfg.TTL).Unix()
+	// Apply snapshot timeout (if set)
+	ctx, cancel := withTimeout(ctx, s.cfg.SnapshotTimeout)
+	defer cancel()
 
-	// Iterate through returned keys
-	for _, key := range keys {
-		if err = s.remove(key, cutoff); err != nil {
-			return
-		}
-	}
+	var (
+		key string
+		ok  bool
+	)
 
-	return
-}
+	// Get new key according to our collision policy
+	if key, ok, err = s.newKey(ctx, getTruncated(time.Now().In(s.cfg.getLocation()), s.cfg.Truncate)); err != nil {
+		// No key was chosen and no start was emitted, so the error is emitted without one
+		s.hooks.emitSnapshotError("", err)
+		return
+	} else if !ok {
+		// Snapshot already exists for this truncated time, skip
+		s.cfg.Logger.Info("snapshot skipped, key already exists", Fields{"name": s.cfg.Name, "key": key})
+		return
+	}
 
-func (s *Snapshotter) remove(key string, cutoff int64) (err error) {
-	var unixTS int64
-	if _, _, unixTS, err = parseKey(key); err != nil {
-		if err == ErrIsLatestKey {
-			return nil
-		}
+	// Create a new manifest for our key
+	m := s.newManifest(key)
+	s.hooks.emitSnapshotStart(key)
 
-		return fmt.Errorf("error parsing key \"%s\": %v", key, err)
+	hash := sha256.New()
+	// Attempt to write to our Writee
+	if err = writeTo(ctx, s.be, key, func(w io.Writer) error {
+		// Wrap writer so we can track the number of bytes written and their checksum
+		cw := newCountWriter(io.MultiWriter(w, hash))
+		defer func() { m.Size = cw.n }()
+		return copyTo(ctx, s.fe, cw)
+	}); err != nil {
+		// Error encountered while writing, return
+		s.hooks.emitSnapshotError(key, err)
+		return
 	}
 
-	if unixTS > cutoff {
+	m.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	m.End = time.Now()
+	m.Duration = m.End.Sub(m.Start)
+
+	// Write the manifest alongside our snapshot
+	if err = s.setManifest(ctx, m); err != nil {
+		s.hooks.emitSnapshotError(key, err)
 		return
 	}
 
-	if err = s.be.Delete(key); err != nil {
-		return fmt.Errorf("error deleting \"%s\": %v", key, err)
+	if s.cfg.SigningKey != nil {
+		// Write the detached signature alongside our snapshot
+		if err = setSignature(ctx, s.be, key, newSignature(s.cfg.SigningKey, key, m.Compression, m.SHA256)); err != nil {
+			s.hooks.emitSnapshotError(key, err)
+			return
+		}
+	}
+
+	// Set our latest key value
+	if err = s.setLatest(ctx, key); err != nil {
+		s.hooks.emitSnapshotError(key, err)
+		return
 	}
 
+	s.hooks.emitSnapshotComplete(key, m.Size, m.Duration)
 	return
 }
 
-func (s *Snapshotter) getLatest() (key string, err error) {
+func (s *Snapshotter) getLatest(ctx context.Context) (key string, err error) {
 	// View latest key's current bytes
-	err = s.be.ReadFrom(s.cfg.Name+".latest.txt", func(r io.Reader) (err error) {
+	err = readFrom(ctx, s.be, s.codec.Latest(s.cfg.Name), func(r io.Reader) (err error) {
 		// Create buffer
 		buf := bytes.NewBuffer(nil)
 		// Copy reader bytes to buffer
@@ -168,9 +315,9 @@ func (s *Snapshotter) getLatest() (key string, err error) {
 	return
 }
 
-func (s *Snapshotter) setLatest(key string) (err error) {
+func (s *Snapshotter) setLatest(ctx context.Context, key string) (err error) {
 	// Set latest key's current bytes
-	err = s.be.WriteTo(s.cfg.Name+".latest.txt", func(w io.Writer) (err error) {
+	err = writeTo(ctx, s.be, s.codec.Latest(s.cfg.Name), func(w io.Writer) (err error) {
 		// Write key as bytes
 		_, err = w.Write([]byte(key))
 		return
@@ -187,11 +334,13 @@ func (s *Snapshotter) Load(key string, fn func(io.Reader) error) (err error) {
 		return errors.ErrIsClosed
 	}
 
-	// Read from back-end
-	return s.be.ReadFrom(key, fn)
+	// Read from back-end and verify the snapshot checksum
+	return s.load(s.work, key, fn)
 }
 
-// Snapshot will call snapshot under the protection of a write-lock
+// Snapshot will request a snapshot from the scheduler and wait for it's result
+// Note: Requests which arrive while a snapshot is running are coalesced into a single
+// snapshot which begins once the running snapshot has completed
 func (s *Snapshotter) Snapshot() (err error) {
 	// Ensure our service hasn't been closed
 	if s.closed.Get() {
@@ -199,12 +348,102 @@ func (s *Snapshotter) Snapshot() (err error) {
 		return errors.ErrIsClosed
 	}
 
-	// Acquire mutex lock
-	s.mu.Lock()
-	// Defer releasing of the mutex lock
-	defer s.mu.Unlock()
-	// Attempt to snapshot
-	return s.snapshot()
+	result := make(chan error, 1)
+	select {
+	case s.requests <- result:
+	case <-s.ctx.Done():
+		// Scheduler has stopped, return
+		return errors.ErrIsClosed
+	}
+
+	return <-result
+}
+
+// Start will begin the background loops of a Snapshotter returned by NewUnstarted
+func (s *Snapshotter) Start() (err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		return errors.ErrIsClosed
+	}
+
+	if !s.start() {
+		return ErrAlreadyStarted
+	}
+
+	return
+}
+
+// Name will return the configured name of the Snapshotter
+func (s *Snapshotter) Name() string {
+	return s.cfg.Name
+}
+
+// Backend will return the back-end of the Snapshotter
+func (s *Snapshotter) Backend() Backend {
+	return s.be
+}
+
+// KeyTime will return the timestamp encoded within the provided key
+func (s *Snapshotter) KeyTime(key string) (t time.Time, err error) {
+	_, _, t, err = s.codec.Decode(key)
+	return
+}
+
+// NextRun will return the time of the next scheduled snapshot
+func (s *Snapshotter) NextRun() (next time.Time) {
+	nano := s.nextRun.Load()
+	if nano == 0 {
+		// Schedule has not been computed yet
+		return
+	}
+
+	return time.Unix(0, nano)
+}
+
+// Pause will pause scheduled snapshots, manual snapshots and purges continue to run
+func (s *Snapshotter) Pause() {
+	s.paused.Set(true)
+}
+
+// Resume will resume scheduled snapshots
+func (s *Snapshotter) Resume() {
+	s.paused.Set(false)
+}
+
+// Paused will return whether or not scheduled snapshots are paused
+func (s *Snapshotter) Paused() bool {
+	return s.paused.Get()
+}
+
+// OnSchedule will register a function to be called when the scheduler skips, queues or coalesces a snapshot
+func (s *Snapshotter) OnSchedule(fn ScheduleFn) {
+	s.hooks.addSchedule(fn)
+}
+
+// OnSnapshotStart will register a function to be called when a snapshot begins
+func (s *Snapshotter) OnSnapshotStart(fn SnapshotStartFn) {
+	s.hooks.addSnapshotStart(fn)
+}
+
+// OnSnapshotComplete will register a function to be called when a snapshot has been successfully written
+func (s *Snapshotter) OnSnapshotComplete(fn SnapshotCompleteFn) {
+	s.hooks.addSnapshotComplete(fn)
+}
+
+// OnSnapshotError will register a function to be called when a snapshot fails
+func (s *Snapshotter) OnSnapshotError(fn SnapshotErrorFn) {
+	s.hooks.addSnapshotError(fn)
+}
+
+// OnCorruption will register a function to be called when a scrub finds a corrupted snapshot
+func (s *Snapshotter) OnCorruption(fn CorruptionFn) {
+	s.hooks.addCorruption(fn)
+}
+
+// OnPurge will register a function to be called when a key has been purged
+func (s *Snapshotter) OnPurge(fn PurgeFn) {
+	s.hooks.addPurge(fn)
 }
 
 // LatestKey will return the last key saved
@@ -216,19 +455,36 @@ func (s *Snapshotter) LatestKey() (key string, err error) {
 		return
 	}
 
-	return s.getLatest()
+	return s.getLatest(s.work)
 }
 
-// Close will close the Snapshotter
+// Close will close the Snapshotter. The background loops are signaled to stop and Close
+// waits (up to Config.CloseTimeout) for any in-flight work to finish. If the timeout elapses,
+// in-flight work is cancelled and Close waits (up to Config.CloseTimeout) once more for the
+// loops to exit. Work which ignores cancellation is abandoned and ErrCloseTimeout is returned
 func (s *Snapshotter) Close() (err error) {
 	if !s.closed.Set(true) {
 		return errors.ErrIsClosed
 	}
 
+	// Defer the cancellation of the work context
+	defer s.halt()
+	// Signal the background loops to stop
+	s.cancel()
+
+	// Wait for the background loops to exit
+	if err = s.wait(s.cfg.CloseTimeout); err != nil {
+		// Close timeout has elapsed, cancel in-flight work and wait for the loops to exit
+		// Note: The wait is bounded, as front-ends and back-ends may ignore cancellation
+		s.halt()
+		s.wait(s.cfg.CloseTimeout)
+		return
+	}
+
 	// Acquire mutex lock
 	s.mu.Lock()
 	// Defer releasing of the mutex lock
 	defer s.mu.Unlock()
 	// Attempt to snapshot once more before closing
-	return s.snapshot()
+	return s.snapshot(s.work)
 }
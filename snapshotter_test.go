@@ -2,6 +2,7 @@ package snapshotter
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +14,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/gdbu/snapshotter/backends"
 	"github.com/gdbu/snapshotter/frontends"
+	"github.com/hatchify/atoms"
 	"github.com/hatchify/errors"
 )
 
@@ -178,3 +180,343 @@ func testSnapshotter(t *testing.T, fe Frontend, be Backend, confirm func(io.Read
 		t.Fatal(err)
 	}
 }
+
+func TestSnapshotter_Close(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	// Initialize a counting front-end
+	fe := &testFrontend{}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to one second
+	cfg.Interval = Second
+	// Set truncate to one sec
+	cfg.Truncate = Second
+
+	// Initialize a new instance of Snapshotter with a cancellable context
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if s, err = NewWithContext(ctx, fe, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow a snapshot to occur
+	time.Sleep(time.Millisecond * 1500)
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Get the count of copies after close (includes the closing snapshot)
+	count := fe.count.Load()
+	// Wait long enough for the loop to have fired again if it were still running
+	time.Sleep(time.Millisecond * 1500)
+
+	if current := fe.count.Load(); current != count {
+		t.Fatalf("invalid copy count after close, expected %d and received %d", count, current)
+	}
+
+	if err = s.Close(); err != errors.ErrIsClosed {
+		t.Fatalf("invalid error, expected %v and received %v", errors.ErrIsClosed, err)
+	}
+}
+
+func TestSnapshotter_CloseStuck(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+	// Initialize a front-end which ignores cancellation
+	fe := &testStuckFrontend{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(fe.release)
+
+	// Initialize configuration, catching up immediately so a snapshot is in-flight
+	cfg := NewConfig("test", "txt")
+	cfg.Interval = Hour
+	cfg.CatchUp = true
+	cfg.CloseTimeout = time.Millisecond * 100
+
+	s, err := New(fe, be, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-fe.started
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.Close()
+	}()
+
+	select {
+	case err = <-closed:
+	case <-time.After(time.Second * 3):
+		t.Fatal("timed out waiting for close to return")
+	}
+
+	if err != ErrCloseTimeout {
+		t.Fatalf("invalid error, expected %v and received %v", ErrCloseTimeout, err)
+	}
+}
+
+// testStuckFrontend is a front-end whose copies block until released, regardless of cancellation
+type testStuckFrontend struct {
+	// Signaled when a copy has started
+	started chan struct{}
+	release chan struct{}
+}
+
+// Copy will block until released
+func (f *testStuckFrontend) Copy(w io.Writer) (err error) {
+	select {
+	case f.started <- struct{}{}:
+	default:
+	}
+
+	<-f.release
+	return
+}
+
+// testFrontend is a front-end which counts the number of times it has been copied
+type testFrontend struct {
+	count atoms.Int64
+}
+
+// Copy will copy to an io.Writer
+func (f *testFrontend) Copy(w io.Writer) (err error) {
+	f.count.Add(1)
+	_, err = w.Write([]byte("hello world"))
+	return
+}
+
+func TestSnapshotter_SnapshotTimeout(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+	// Set snapshot timeout to a short duration
+	cfg.SnapshotTimeout = time.Millisecond * 100
+
+	if s, err = New(&testBlockingFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != context.DeadlineExceeded {
+		t.Fatalf("invalid error, expected %v and received %v", context.DeadlineExceeded, err)
+	}
+
+	var keys []string
+	if keys, err = be.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 0 {
+		t.Fatalf("invalid number of keys, expected partial output to be removed and found %v", keys)
+	}
+}
+
+// testBlockingFrontend is a front-end which writes partial output and blocks until it's context is done
+type testBlockingFrontend struct{}
+
+// Copy will copy to an io.Writer
+func (f *testBlockingFrontend) Copy(w io.Writer) (err error) {
+	return f.CopyContext(context.Background(), w)
+}
+
+// CopyContext will copy to an io.Writer until the context is done
+func (f *testBlockingFrontend) CopyContext(ctx context.Context, w io.Writer) (err error) {
+	if _, err = w.Write([]byte("partial")); err != nil {
+		return
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSnapshotter_Hooks(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var (
+		started   string
+		completed string
+		size      int64
+		nested    atoms.Int64
+	)
+
+	s.OnSnapshotStart(func(key string) {
+		started = key
+		// Hooks may register other hooks
+		s.OnSnapshotStart(func(key string) {
+			nested.Add(1)
+		})
+	})
+
+	s.OnSnapshotComplete(func(key string, n int64, duration time.Duration) {
+		completed = key
+		size = n
+	})
+
+	// Hooks are called by the scheduler, errors are sent to the test goroutine
+	errs := make(chan error, 1)
+	s.OnSnapshotError(func(key string, err error) {
+		select {
+		case errs <- fmt.Errorf("unexpected snapshot error for \"%s\": %v", key, err):
+		default:
+		}
+	})
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-errs:
+		t.Fatal(err)
+	default:
+	}
+
+	// The hook registered during the first snapshot is called by the second
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := nested.Load(); n != 1 {
+		t.Fatalf("invalid number of nested hook calls, expected %d and received %d", 1, n)
+	}
+
+	if started == "" || started != completed {
+		t.Fatalf("invalid hook keys, started \"%s\" and completed \"%s\"", started, completed)
+	}
+
+	if size != int64(len("hello world")) {
+		t.Fatalf("invalid size, expected %d and received %d", len("hello world"), size)
+	}
+}
+
+func TestSnapshotter_Start(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Catch up immediately, the snapshot runs as the Snapshotter starts
+	cfg := NewConfig("test", "txt")
+	cfg.Interval = Hour
+	cfg.CatchUp = true
+
+	s, err := NewUnstarted(context.Background(), &testFrontend{}, be, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed atoms.Int64
+	s.OnSnapshotComplete(func(key string, n int64, duration time.Duration) {
+		completed.Add(1)
+	})
+
+	// Nothing runs until the Snapshotter has been started
+	time.Sleep(time.Millisecond * 50)
+	if n := completed.Load(); n != 0 {
+		t.Fatalf("invalid number of snapshots before starting, expected %d and received %d", 0, n)
+	}
+
+	if err = s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return completed.Load() == 1 })
+
+	if err = s.Start(); err != ErrAlreadyStarted {
+		t.Fatalf("invalid error, expected %v and received %v", ErrAlreadyStarted, err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Start(); err != errors.ErrIsClosed {
+		t.Fatalf("invalid error, expected %v and received %v", errors.ErrIsClosed, err)
+	}
+}
+
+func TestSnapshotter_HooksEarlyError(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend which cannot list
+	be := &testFailingListBackend{Backend: backends.NewFile(backendTestDir)}
+
+	cfg := NewConfig("test", "txt")
+	cfg.CollisionPolicy = CollisionSkip
+
+	// Initialize a Snapshotter without background loops, whose semaphore is already held
+	s := &Snapshotter{fe: &testFrontend{}, be: be, cfg: cfg, codec: DefaultKeyCodec, sem: newSemaphore(1)}
+	s.sem.acquire(context.Background())
+
+	var errs []error
+	s.OnSnapshotError(func(key string, err error) {
+		errs = append(errs, err)
+	})
+
+	// Errors acquiring the semaphore are emitted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.attempt(ctx); err != context.Canceled {
+		t.Fatalf("invalid error, expected %v and received %v", context.Canceled, err)
+	}
+
+	// Errors choosing a key are emitted
+	s.sem.release()
+	if err := s.attempt(context.Background()); err != errTestTransient {
+		t.Fatalf("invalid error, expected %v and received %v", errTestTransient, err)
+	}
+
+	if len(errs) != 2 || errs[0] != context.Canceled || errs[1] != errTestTransient {
+		t.Fatalf("invalid emitted errors, expected %v and received %v", []error{context.Canceled, errTestTransient}, errs)
+	}
+}
+
+// testFailingListBackend is a back-end which fails every list
+type testFailingListBackend struct {
+	Backend
+}
+
+// List will return a transient error
+func (f *testFailingListBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return nil, errTestTransient
+}
@@ -0,0 +1,698 @@
+package snapshotter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrSpoolFull is returned when a write would exceed the bounds of the spool
+const ErrSpoolFull = errors.Error("spool is full, cannot accept write until pending entries have been uploaded")
+
+const (
+	// spoolDataExt is the extension of spooled values
+	spoolDataExt = ".data"
+	// spoolKeyExt is the extension of spooled keys, an entry is only committed once it's key has been written
+	spoolKeyExt = ".key"
+	// spoolTempExt is the extension of partially written keys
+	spoolTempExt = ".tmp"
+	// spoolDeadDir is the directory (within the spool directory) entries are moved to once they exceed their attempts
+	spoolDeadDir = "dead"
+)
+
+// SpoolOptions are the options for a SpoolingBackend
+type SpoolOptions struct {
+	// MaxBytes is the maximum number of bytes which may be spooled
+	// Note: A value of zero will not limit the number of bytes
+	MaxBytes int64
+	// MaxEntries is the maximum number of entries which may be spooled
+	// Note: A value of zero will not limit the number of entries
+	MaxEntries int
+	// RetryInterval is how long to wait before retrying a failed upload
+	// Note: A value of zero will default to one minute
+	RetryInterval time.Duration
+	// MaxAttempts is the maximum number of times an entry is uploaded before it is moved to the
+	// "dead" directory within the spool directory, so the entries which follow it can be uploaded
+	// Note: A value of zero will retry failed uploads indefinitely
+	MaxAttempts int
+	// Logger is used to report failed uploads
+	// Note: A nil value will log to stdout using the standard library logger
+	Logger Logger
+}
+
+// SpoolErrorFn is called when the upload of a spooled entry fails, dead is true when the
+// entry has exceeded it's attempts and was moved out of the spool
+type SpoolErrorFn func(key string, attempt int, err error, dead bool)
+
+// NewSpoolingBackend returns a back-end decorator which writes to a local spool directory and uploads
+// spooled entries to the provided back-end in the background. Entries which were spooled before a restart
+// are uploaded once the spool is re-opened
+func NewSpoolingBackend(be Backend, dir string, opts SpoolOptions) (sp *SpoolingBackend, err error) {
+	var s SpoolingBackend
+	if err = os.MkdirAll(dir, 0744); err != nil {
+		return
+	}
+
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = Minute
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = defaultLogger
+	}
+
+	s.be = be
+	s.dir = dir
+	s.opts = opts
+	s.wake = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	// Load entries which were spooled before a restart
+	if err = s.load(); err != nil {
+		return
+	}
+
+	go s.uploadLoop()
+	sp = &s
+	return
+}
+
+// SpoolingBackend is a back-end decorator which acknowledges writes once they have been spooled locally
+// Note: Pending entries are visible to ReadFrom, List and Next before they have been uploaded
+type SpoolingBackend struct {
+	mu sync.RWMutex
+
+	be   Backend
+	dir  string
+	opts SpoolOptions
+
+	// Pending entries, oldest first
+	entries []spoolEntry
+	// Total size of pending entries
+	bytes int64
+	// Sequence number of the next entry
+	seq uint64
+	// Number of entries being written, each holds a reservation against MaxEntries
+	writing int
+	// Bytes written by entries which have not been committed yet, these are reserved against MaxBytes
+	reserved int64
+
+	// Upload which is in-flight (if any)
+	inflight *spoolUpload
+
+	onUploadError []SpoolErrorFn
+
+	// Signals the upload loop that an entry has been spooled
+	wake chan struct{}
+	// Closed once the upload loop has exited
+	done chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// spoolEntry is a single spooled write
+type spoolEntry struct {
+	seq  uint64
+	key  string
+	size int64
+}
+
+// spoolUpload is an in-flight upload of a spooled entry
+type spoolUpload struct {
+	entry spoolEntry
+
+	// Context of the upload and it's associated cancel func
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Closed once the upload has finished
+	done chan struct{}
+}
+
+// WriteTo will pass a writer to the provided function
+func (s *SpoolingBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	return s.WriteToContext(context.Background(), key, fn)
+}
+
+// WriteToContext will spool the value written by the provided function, the value is
+// uploaded to the underlying back-end in the background
+// Note: The entry is reserved before writing and bytes are reserved as they are written, so
+// ErrSpoolFull is returned as soon as a write would exceed the bounds of the spool
+func (s *SpoolingBackend) WriteToContext(ctx context.Context, key string, fn func(io.Writer) error) (err error) {
+	// Ensure our context hasn't been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.isFull() {
+		s.mu.Unlock()
+		return ErrSpoolFull
+	}
+
+	seq := s.seq
+	s.seq++
+	s.writing++
+	s.mu.Unlock()
+
+	var size int64
+	size, err = s.writeEntry(ctx, seq, key, fn)
+
+	s.mu.Lock()
+	// Release our reservations, the entry is accounted for below once committed
+	s.writing--
+	s.reserved -= size
+	if err != nil {
+		s.mu.Unlock()
+		s.removeEntry(seq)
+		return
+	}
+
+	s.entries = append(s.entries, spoolEntry{seq: seq, key: key, size: size})
+	// Entries are kept in sequence order, concurrent writes may finish out of order
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].seq < s.entries[j].seq
+	})
+
+	s.bytes += size
+	s.mu.Unlock()
+
+	// Notify the upload loop
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return
+}
+
+// ReadFrom will pass a reader to the provided function
+func (s *SpoolingBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	return s.ReadFromContext(context.Background(), key, fn)
+}
+
+// ReadFromContext will pass a reader to the provided function, pending entries are read from the spool
+func (s *SpoolingBackend) ReadFromContext(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	entry, ok := s.pending(key)
+	if !ok {
+		return readFrom(ctx, s.be, key, fn)
+	}
+
+	var f *os.File
+	if f, err = os.Open(s.dataPath(entry.seq)); os.IsNotExist(err) {
+		// Entry was uploaded after we found it pending, read from the underlying back-end
+		return readFrom(ctx, s.be, key, fn)
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+
+	return fn(f)
+}
+
+// Delete will delete a key
+func (s *SpoolingBackend) Delete(key string) (err error) {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext will delete a key, pending entries for the key are removed from the spool
+// Note: An in-flight upload of the key is cancelled (and waited on) before deleting from the
+// underlying back-end, so the upload cannot re-create the key. Errors from the underlying
+// back-end are ignored when the key was pending, as the key may not have been uploaded yet
+func (s *SpoolingBackend) DeleteContext(ctx context.Context, key string) (err error) {
+	s.mu.Lock()
+	inflight := s.inflight
+	if inflight != nil && inflight.entry.key != key {
+		inflight = nil
+	}
+
+	var removed []spoolEntry
+	entries := s.entries[:0]
+	for _, entry := range s.entries {
+		if entry.key == key {
+			removed = append(removed, entry)
+			s.bytes -= entry.size
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	s.entries = entries
+	s.mu.Unlock()
+
+	if inflight != nil {
+		// Cancel the upload of our key and wait for it to finish
+		inflight.cancel()
+		<-inflight.done
+	}
+
+	for _, entry := range removed {
+		s.removeEntry(entry.seq)
+	}
+
+	if err = deleteKey(ctx, s.be, key); err != nil && len(removed) > 0 {
+		err = nil
+	}
+
+	return
+}
+
+// List will list the available keys
+func (s *SpoolingBackend) List(prefix, marker string, maxKeys int64) (keys []string, err error) {
+	return s.ListContext(context.Background(), prefix, marker, maxKeys)
+}
+
+// ListContext will list the available keys, including pending entries
+func (s *SpoolingBackend) ListContext(ctx context.Context, prefix, marker string, maxKeys int64) (keys []string, err error) {
+	if keys, err = list(ctx, s.be, prefix, marker, maxKeys); err != nil {
+		return
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key] = true
+	}
+
+	s.mu.RLock()
+	for _, entry := range s.entries {
+		if seen[entry.key] || !strings.HasPrefix(entry.key, prefix) || entry.key <= marker {
+			continue
+		}
+
+		seen[entry.key] = true
+		keys = append(keys, entry.key)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(keys)
+	if maxKeys > -1 && int64(len(keys)) > maxKeys {
+		keys = keys[:maxKeys]
+	}
+
+	return
+}
+
+// Next will return the next key
+func (s *SpoolingBackend) Next(prefix, marker string) (nextKey string, err error) {
+	return s.NextContext(context.Background(), prefix, marker)
+}
+
+// NextContext will return the next key, including pending entries
+func (s *SpoolingBackend) NextContext(ctx context.Context, prefix, marker string) (nextKey string, err error) {
+	var keys []string
+	if keys, err = s.ListContext(ctx, prefix, marker, 1); err != nil {
+		return
+	}
+
+	if len(keys) == 0 {
+		return "", io.EOF
+	}
+
+	return keys[0], nil
+}
+
+// Depth will return the number of pending entries
+func (s *SpoolingBackend) Depth() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// DepthBytes will return the total size of the pending entries
+func (s *SpoolingBackend) DepthBytes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bytes
+}
+
+// OnUploadError will register a function to be called when the upload of a spooled entry fails
+func (s *SpoolingBackend) OnUploadError(fn SpoolErrorFn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onUploadError = append(s.onUploadError, fn)
+}
+
+// Unwrap will return the underlying back-end
+func (s *SpoolingBackend) Unwrap() Backend {
+	return s.be
+}
+
+// Close will stop the upload loop, pending entries remain spooled and are uploaded once the spool is re-opened
+func (s *SpoolingBackend) Close() (err error) {
+	s.cancel()
+	<-s.done
+	return
+}
+
+// uploadLoop will upload pending entries in order until the spool is closed
+func (s *SpoolingBackend) uploadLoop() {
+	defer close(s.done)
+
+	var (
+		// Sequence number of the entry being uploaded and it's number of failed attempts
+		seq      uint64
+		attempts int
+	)
+
+	for {
+		upload, ok := s.start()
+		if !ok {
+			// Nothing to upload, wait for an entry to be spooled
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+
+		entry := upload.entry
+		if entry.seq != seq {
+			seq = entry.seq
+			attempts = 0
+		}
+
+		err := s.upload(upload.ctx, entry)
+		// The upload is cancelled once finished, check whether the entry was deleted beforehand
+		deleted := upload.ctx.Err() != nil
+		s.finish(upload)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+
+			if deleted {
+				// Entry was deleted during the upload, continue
+				continue
+			}
+
+			attempts++
+			if s.opts.MaxAttempts > 0 && attempts >= s.opts.MaxAttempts {
+				// Entry has exceeded it's attempts, move it aside so the following entries can be uploaded
+				derr := s.deadLetter(entry)
+				if derr == nil {
+					s.opts.Logger.Error("error uploading spooled entry, attempts exceeded", Fields{"key": entry.key, "attempts": attempts, "error": err})
+					s.emitUploadError(entry.key, attempts, err, true)
+					continue
+				}
+
+				s.opts.Logger.Error("error moving spooled entry to the dead directory", Fields{"key": entry.key, "error": derr})
+			}
+
+			s.emitUploadError(entry.key, attempts, err, false)
+			s.opts.Logger.Warning("error uploading spooled entry, retrying", Fields{"key": entry.key, "retryIn": s.opts.RetryInterval, "error": err})
+			timer := time.NewTimer(s.opts.RetryInterval)
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			continue
+		}
+
+		s.pop(entry)
+	}
+}
+
+// upload will write a pending entry to the underlying back-end
+func (s *SpoolingBackend) upload(ctx context.Context, entry spoolEntry) (err error) {
+	var f *os.File
+	if f, err = os.Open(s.dataPath(entry.seq)); err != nil {
+		if os.IsNotExist(err) {
+			// Entry was deleted while we were uploading, there is nothing to upload
+			return nil
+		}
+
+		return
+	}
+	defer f.Close()
+
+	return writeTo(ctx, s.be, entry.key, func(w io.Writer) (err error) {
+		_, err = io.Copy(w, f)
+		return
+	})
+}
+
+// start will mark the oldest pending entry as in-flight and return it's upload
+// Note: The entry is marked while the lock is held, so a concurrent Delete will
+// either remove the entry before it is started or cancel it's upload
+func (s *SpoolingBackend) start() (upload *spoolUpload, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return
+	}
+
+	var u spoolUpload
+	u.entry = s.entries[0]
+	u.ctx, u.cancel = context.WithCancel(s.ctx)
+	u.done = make(chan struct{})
+	s.inflight = &u
+	return &u, true
+}
+
+// finish will clear an in-flight upload once it has finished
+func (s *SpoolingBackend) finish(upload *spoolUpload) {
+	s.mu.Lock()
+	s.inflight = nil
+	s.mu.Unlock()
+
+	upload.cancel()
+	close(upload.done)
+}
+
+// pop will remove an uploaded entry from the spool
+func (s *SpoolingBackend) pop(entry spoolEntry) {
+	s.drop(entry)
+	s.removeEntry(entry.seq)
+}
+
+// deadLetter will move an entry which has exceeded it's attempts to the dead directory
+// Note: The key is moved first, an entry whose data remains is not loaded after a restart
+func (s *SpoolingBackend) deadLetter(entry spoolEntry) (err error) {
+	dir := filepath.Join(s.dir, spoolDeadDir)
+	if err = os.MkdirAll(dir, 0744); err != nil {
+		return
+	}
+
+	for _, filename := range []string{s.keyPath(entry.seq), s.dataPath(entry.seq)} {
+		if err = os.Rename(filename, filepath.Join(dir, filepath.Base(filename))); os.IsNotExist(err) {
+			// A previous attempt may have moved the file before failing
+			err = nil
+		} else if err != nil {
+			return
+		}
+	}
+
+	s.drop(entry)
+	return
+}
+
+// drop will remove an entry from the pending entries
+func (s *SpoolingBackend) drop(entry spoolEntry) {
+	s.mu.Lock()
+	for i, e := range s.entries {
+		if e.seq != entry.seq {
+			continue
+		}
+
+		s.entries = append(s.entries[:i], s.entries[i+1:]...)
+		s.bytes -= e.size
+		break
+	}
+	s.mu.Unlock()
+}
+
+// emitUploadError will call the upload error functions
+// Note: The functions are called without holding the lock, so they may call the spool
+func (s *SpoolingBackend) emitUploadError(key string, attempt int, err error, dead bool) {
+	s.mu.RLock()
+	fns := append([]SpoolErrorFn(nil), s.onUploadError...)
+	s.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key, attempt, err, dead)
+	}
+}
+
+// pending will return the newest pending entry for the provided key
+func (s *SpoolingBackend) pending(key string) (entry spoolEntry, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if s.entries[i].key == key {
+			return s.entries[i], true
+		}
+	}
+
+	return
+}
+
+// isFull will determine if another entry (including those being written) would exceed the maximum number of entries
+// Note: This is expected to be called while the lock is held
+func (s *SpoolingBackend) isFull() bool {
+	return s.opts.MaxEntries > 0 && len(s.entries)+s.writing >= s.opts.MaxEntries
+}
+
+// reserve will reserve the provided number of bytes for an entry being written
+func (s *SpoolingBackend) reserve(n int64) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.MaxBytes > 0 && s.bytes+s.reserved+n > s.opts.MaxBytes {
+		return ErrSpoolFull
+	}
+
+	s.reserved += n
+	return
+}
+
+// writeEntry will write the value and key of an entry to the spool directory, the returned
+// size is the number of bytes reserved while writing (even when an error is returned)
+// Note: The key is written last, so entries are only loaded after a restart once complete
+func (s *SpoolingBackend) writeEntry(ctx context.Context, seq uint64, key string, fn func(io.Writer) error) (size int64, err error) {
+	var f *os.File
+	if f, err = os.Create(s.dataPath(seq)); err != nil {
+		return
+	}
+	defer f.Close()
+
+	rw := newReservingWriter(s, newContextWriter(ctx, f))
+	err = fn(rw)
+	size = rw.n
+	if err != nil {
+		return
+	}
+
+	// Ensure our context wasn't cancelled after the last write
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if err = f.Sync(); err != nil {
+		return
+	}
+
+	tmp := s.keyPath(seq) + spoolTempExt
+	if err = ioutil.WriteFile(tmp, []byte(key), 0644); err != nil {
+		return
+	}
+
+	if err = os.Rename(tmp, s.keyPath(seq)); err != nil {
+		return
+	}
+
+	return
+}
+
+// removeEntry will remove the files of an entry from the spool directory
+func (s *SpoolingBackend) removeEntry(seq uint64) {
+	os.Remove(s.keyPath(seq))
+	os.Remove(s.keyPath(seq) + spoolTempExt)
+	os.Remove(s.dataPath(seq))
+}
+
+// load will load the committed entries within the spool directory and remove incomplete entries
+func (s *SpoolingBackend) load() (err error) {
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(s.dir); err != nil {
+		return
+	}
+
+	committed := make(map[uint64]bool)
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasSuffix(name, spoolKeyExt) {
+			continue
+		}
+
+		seq, perr := strconv.ParseUint(strings.TrimSuffix(name, spoolKeyExt), 10, 64)
+		if perr != nil {
+			continue
+		}
+
+		var (
+			key  []byte
+			data os.FileInfo
+		)
+
+		if key, err = ioutil.ReadFile(filepath.Join(s.dir, name)); err != nil {
+			return
+		}
+
+		if data, err = os.Stat(s.dataPath(seq)); err != nil {
+			return fmt.Errorf("error loading spooled entry \"%s\": %v", key, err)
+		}
+
+		committed[seq] = true
+		s.entries = append(s.entries, spoolEntry{seq: seq, key: string(key), size: data.Size()})
+		s.bytes += data.Size()
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+	}
+
+	// Remove entries which were not committed before a restart
+	for _, info := range infos {
+		name := info.Name()
+		// Entry files are named by their sequence number, followed by one or more extensions
+		seq, perr := strconv.ParseUint(strings.SplitN(name, ".", 2)[0], 10, 64)
+		if perr == nil && !committed[seq] {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].seq < s.entries[j].seq
+	})
+
+	return
+}
+
+// newReservingWriter will return a new writer which reserves spool bytes before writing to the provided writer
+func newReservingWriter(s *SpoolingBackend, w io.Writer) *reservingWriter {
+	var r reservingWriter
+	r.s = s
+	r.w = w
+	return &r
+}
+
+// reservingWriter reserves spool bytes before writing to it's underlying writer
+type reservingWriter struct {
+	s *SpoolingBackend
+	w io.Writer
+	// Number of bytes reserved
+	n int64
+}
+
+// Write will reserve the bytes and write to the underlying writer, ErrSpoolFull is
+// returned (before anything is written) when the bytes would exceed the bounds of the spool
+func (r *reservingWriter) Write(bs []byte) (n int, err error) {
+	if err = r.s.reserve(int64(len(bs))); err != nil {
+		return
+	}
+
+	r.n += int64(len(bs))
+	return r.w.Write(bs)
+}
+
+func (s *SpoolingBackend) dataPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolDataExt))
+}
+
+func (s *SpoolingBackend) keyPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolKeyExt))
+}
@@ -0,0 +1,431 @@
+package snapshotter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+)
+
+func TestSpoolingBackend(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	spoolDir := filepath.Join(backendTestDir, "spool")
+	remote := backends.NewFile(filepath.Join(backendTestDir, "remote"))
+	be := &testOfflineBackend{Backend: remote}
+	be.offline.Set(true)
+
+	opts := SpoolOptions{MaxEntries: 2, RetryInterval: time.Millisecond * 10}
+	sb, err := NewSpoolingBackend(be, spoolDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(sb *SpoolingBackend, key, value string) error {
+		return sb.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte(value))
+			return
+		})
+	}
+
+	// Writes are acknowledged while the remote is unavailable
+	if err = write(sb, "test.1.txt", "one"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = write(sb, "test.2.txt", "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = write(sb, "test.3.txt", "three"); err != ErrSpoolFull {
+		t.Fatalf("invalid error, expected %v and received %v", ErrSpoolFull, err)
+	}
+
+	if depth := sb.Depth(); depth != 2 {
+		t.Fatalf("invalid depth, expected %d and received %d", 2, depth)
+	}
+
+	testSpoolValue(t, sb, "test.1.txt", "one")
+
+	// Simulate a restart, pending entries must survive
+	if err = sb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sb, err = NewSpoolingBackend(be, spoolDir, opts); err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	if depth := sb.Depth(); depth != 2 {
+		t.Fatalf("invalid depth after restart, expected %d and received %d", 2, depth)
+	}
+
+	if bytes := sb.DepthBytes(); bytes != int64(len("one")+len("two")) {
+		t.Fatalf("invalid depth bytes after restart, expected %d and received %d", len("one")+len("two"), bytes)
+	}
+
+	// Bring the remote back, pending entries are uploaded in order
+	be.offline.Set(false)
+	waitFor(t, func() bool { return sb.Depth() == 0 })
+
+	var keys []string
+	if keys, err = remote.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0] != "test.1.txt" || keys[1] != "test.2.txt" {
+		t.Fatalf("invalid remote keys, expected %v and received %v", []string{"test.1.txt", "test.2.txt"}, keys)
+	}
+
+	testSpoolValue(t, sb, "test.2.txt", "two")
+
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(spoolDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 0 {
+		t.Fatalf("invalid number of spool files, expected %d and received %d", 0, len(infos))
+	}
+}
+
+func TestSpoolingBackend_Bounds(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	spoolDir := filepath.Join(backendTestDir, "spool")
+	be := &testOfflineBackend{Backend: backends.NewFile(filepath.Join(backendTestDir, "remote"))}
+	be.offline.Set(true)
+
+	opts := SpoolOptions{MaxBytes: 8, MaxEntries: 2, RetryInterval: time.Millisecond * 10}
+	sb, err := NewSpoolingBackend(be, spoolDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	// Writes which exceed the bytes are rejected as they are written
+	if err = sb.WriteTo("test.1.txt", func(w io.Writer) (err error) {
+		if _, err = w.Write([]byte("hello ")); err != nil {
+			t.Fatalf("invalid error, expected nil and received %v", err)
+		}
+
+		_, err = w.Write([]byte("world"))
+		return
+	}); err != ErrSpoolFull {
+		t.Fatalf("invalid error, expected %v and received %v", ErrSpoolFull, err)
+	}
+
+	if depth, bytes := sb.Depth(), sb.DepthBytes(); depth != 0 || bytes != 0 {
+		t.Fatalf("invalid depth, expected (0, 0) and received (%d, %d)", depth, bytes)
+	}
+
+	// Concurrent writes are bounded by the bytes and entries reserved by in-flight writes
+	written := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sb.WriteTo("test.2.txt", func(w io.Writer) (err error) {
+			if _, err = w.Write([]byte("hello")); err != nil {
+				return
+			}
+
+			close(written)
+			<-release
+			return
+		})
+	}()
+
+	<-written
+	if err = sb.WriteTo("test.3.txt", func(w io.Writer) (err error) {
+		_, err = w.Write([]byte("world"))
+		return
+	}); err != ErrSpoolFull {
+		t.Fatalf("invalid error, expected %v and received %v", ErrSpoolFull, err)
+	}
+
+	if err = sb.WriteTo("test.4.txt", func(w io.Writer) (err error) {
+		_, err = w.Write([]byte("hi"))
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var called bool
+	if err = sb.WriteTo("test.5.txt", func(w io.Writer) (err error) {
+		called = true
+		return
+	}); err != ErrSpoolFull || called {
+		t.Fatalf("invalid result, expected %v without writing and received %v (written: %v)", ErrSpoolFull, err, called)
+	}
+
+	close(release)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if depth, bytes := sb.Depth(), sb.DepthBytes(); depth != 2 || bytes != int64(len("hello")+len("hi")) {
+		t.Fatalf("invalid depth, expected (2, %d) and received (%d, %d)", len("hello")+len("hi"), depth, bytes)
+	}
+
+	// Writes fail once their context is done
+	sb.Delete("test.4.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = sb.WriteToContext(ctx, "test.6.txt", func(w io.Writer) (err error) {
+		cancel()
+		_, err = w.Write([]byte("hi"))
+		return
+	}); err != context.Canceled {
+		t.Fatalf("invalid error, expected %v and received %v", context.Canceled, err)
+	}
+
+	if depth, bytes := sb.Depth(), sb.DepthBytes(); depth != 1 || bytes != int64(len("hello")) {
+		t.Fatalf("invalid depth, expected (1, %d) and received (%d, %d)", len("hello"), depth, bytes)
+	}
+}
+
+func TestSpoolingBackend_DeleteUploading(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	spoolDir := filepath.Join(backendTestDir, "spool")
+	remote := backends.NewFile(filepath.Join(backendTestDir, "remote"))
+	be := &testSlowBackend{Backend: remote, started: make(chan struct{}, 1), release: make(chan struct{})}
+
+	sb, err := NewSpoolingBackend(be, spoolDir, SpoolOptions{RetryInterval: time.Millisecond * 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	if err = sb.WriteTo("test.1.txt", func(w io.Writer) (err error) {
+		_, err = w.Write([]byte("one"))
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the key while it's upload is in-flight
+	<-be.started
+	deleted := make(chan error, 1)
+	go func() {
+		deleted <- sb.Delete("test.1.txt")
+	}()
+
+	select {
+	case err = <-deleted:
+		// Continue so the upload is released and the spool can be closed
+		t.Errorf("expected delete to wait for the in-flight upload and received %v", err)
+		deleted <- err
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(be.release)
+	if err = <-deleted; err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the upload loop to finish with the entry
+	waitFor(t, func() bool { return sb.Depth() == 0 })
+
+	// The upload must not re-create the deleted key
+	var keys []string
+	if keys, err = remote.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 0 || sb.Depth() != 0 {
+		t.Fatalf("invalid state, expected no remote keys or pending entries and received %v (depth %d)", keys, sb.Depth())
+	}
+}
+
+func TestSpoolingBackend_ReadUploaded(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	spoolDir := filepath.Join(backendTestDir, "spool")
+	remote := backends.NewFile(filepath.Join(backendTestDir, "remote"))
+	be := &testOfflineBackend{Backend: remote}
+	be.offline.Set(true)
+
+	sb, err := NewSpoolingBackend(be, spoolDir, SpoolOptions{RetryInterval: Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	for _, b := range []Backend{sb, remote} {
+		if err = b.WriteTo("test.1.txt", func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("one"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate the entry being uploaded after it was found pending, but before it was opened
+	entry, ok := sb.pending("test.1.txt")
+	if !ok {
+		t.Fatal("expected the entry to be pending")
+	}
+
+	if err = os.Remove(sb.dataPath(entry.seq)); err != nil {
+		t.Fatal(err)
+	}
+
+	testSpoolValue(t, sb, "test.1.txt", "one")
+}
+
+func TestSpoolingBackend_MaxAttempts(t *testing.T) {
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	spoolDir := filepath.Join(backendTestDir, "spool")
+	remote := backends.NewFile(filepath.Join(backendTestDir, "remote"))
+	be := &testRejectingBackend{Backend: remote, key: "test.1.txt"}
+
+	opts := SpoolOptions{RetryInterval: time.Millisecond * 10, MaxAttempts: 3}
+	sb, err := NewSpoolingBackend(be, spoolDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	var failures atoms.Int64
+	dead := make(chan int, 1)
+	sb.OnUploadError(func(key string, attempt int, err error, isDead bool) {
+		failures.Add(1)
+		if isDead {
+			dead <- attempt
+		}
+	})
+
+	for _, key := range []string{"test.1.txt", "test.2.txt"} {
+		if err = sb.WriteTo(key, func(w io.Writer) (err error) {
+			_, err = w.Write([]byte("hello world"))
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The rejected entry is moved aside, so the following entry is uploaded
+	waitFor(t, func() bool { return sb.Depth() == 0 })
+
+	select {
+	case attempt := <-dead:
+		if attempt != 3 {
+			t.Fatalf("invalid attempt, expected %d and received %d", 3, attempt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the rejected entry to be reported")
+	}
+
+	if count := failures.Load(); count != 3 {
+		t.Fatalf("invalid number of failures, expected %d and received %d", 3, count)
+	}
+
+	var keys []string
+	if keys, err = remote.List("test", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0] != "test.2.txt" {
+		t.Fatalf("invalid remote keys, expected [test.2.txt] and received %v", keys)
+	}
+
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(filepath.Join(spoolDir, spoolDeadDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("invalid number of dead files, expected %d and received %d", 2, len(infos))
+	}
+
+	// Dead entries are not loaded when the spool is re-opened
+	if err = sb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sb, err = NewSpoolingBackend(be, spoolDir, opts); err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	if depth := sb.Depth(); depth != 0 {
+		t.Fatalf("invalid depth after restart, expected %d and received %d", 0, depth)
+	}
+}
+
+func testSpoolValue(t *testing.T, sb *SpoolingBackend, key, expected string) {
+	if err := sb.ReadFrom(key, func(r io.Reader) (err error) {
+		var bs []byte
+		if bs, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+
+		if string(bs) != expected {
+			t.Fatalf("invalid value, expected \"%s\" and received \"%s\"", expected, string(bs))
+		}
+
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testOfflineBackend is a back-end which fails every write while offline
+type testOfflineBackend struct {
+	Backend
+
+	offline atoms.Bool
+}
+
+// WriteTo will pass a writer to the provided function
+func (o *testOfflineBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	if o.offline.Get() {
+		return errTestTransient
+	}
+
+	return o.Backend.WriteTo(key, fn)
+}
+
+// testSlowBackend is a back-end whose writes block until released, regardless of their context
+type testSlowBackend struct {
+	Backend
+
+	// Signaled when a write has started
+	started chan struct{}
+	release chan struct{}
+}
+
+// WriteTo will block until released before writing to the underlying back-end
+func (s *testSlowBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+
+	<-s.release
+	return s.Backend.WriteTo(key, fn)
+}
+
+// testRejectingBackend is a back-end which always fails writes to a key
+type testRejectingBackend struct {
+	Backend
+
+	key string
+}
+
+// WriteTo will pass a writer to the provided function
+func (r *testRejectingBackend) WriteTo(key string, fn func(io.Writer) error) (err error) {
+	if key == r.key {
+		return errTestTransient
+	}
+
+	return r.Backend.WriteTo(key, fn)
+}
@@ -1,10 +1,9 @@
 package snapshotter
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -17,57 +16,28 @@ const (
 	Hour = time.Hour
 	// Day represents a day
 	Day = Hour * 24
+	// Week represents a week
+	Week = Day * 7
 	// Month represents a month
 	Month = Day * 30
 	// Year represents a year
 	Year = Day * 365
 )
 
-func getKey(name, ext string, truncate time.Duration) (key string) {
-	// Get truncated unix timestamp
-	unix := getTruncatedUnix(truncate)
-	// Return formatted string utilizing name, unix timestamp, and the extension
-	return fmt.Sprintf("%s.%d.%s", name, unix, ext)
-}
-
-func parseKey(key string) (name, ext string, unixTS int64, err error) {
-	spl := strings.Split(key, ".")
-	if len(spl) != 3 {
-		err = ErrInvalidKey
-		return
-	}
-
-	if spl[1] == "latest" {
-		err = ErrIsLatestKey
-		return
-	}
-
-	if unixTS, err = strconv.ParseInt(spl[1], 10, 64); err != nil {
-		return
-	}
-
-	name = spl[0]
-	ext = spl[2]
-	return
-}
-
-func getTruncatedUnix(truncate time.Duration) (unix int64) {
-	// Get current time
-	now := time.Now()
-	// Truncate time to truncate value
-	truncated := getTruncated(now, truncate)
-	// Get the nano Unix timestamp
-	return truncated.Unix()
-}
-
+// getTruncated will truncate the provided time to the start of it's second, minute, hour, day,
+// ISO week (beginning Monday), month or year within the time's location
 func getTruncated(t time.Time, truncate time.Duration) (truncated time.Time) {
 	switch truncate {
 	case Year:
-		return time.Date(t.Year(), time.January, 0, 0, 0, 0, 0, t.Location())
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
 	case Month:
-		return time.Date(t.Year(), t.Month(), 0, 0, 0, 0, 0, t.Location())
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case Week:
+		// Go weeks begin on Sunday, shift so that Monday is the first day of the week
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
 	case Day:
-		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 	case Hour:
 		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
 	case Minute:
@@ -81,11 +51,32 @@ func getTruncated(t time.Time, truncate time.Duration) (truncated time.Time) {
 	}
 }
 
+// getTruncatedEnd will return the end of the truncation window which begins at the provided truncated time
+func getTruncatedEnd(t time.Time, truncate time.Duration) (end time.Time) {
+	switch truncate {
+	case Year:
+		return t.AddDate(1, 0, 0)
+	case Month:
+		return t.AddDate(0, 1, 0)
+	case Week:
+		return t.AddDate(0, 0, 7)
+	case Day:
+		return t.AddDate(0, 0, 1)
+
+	default:
+		return t.Add(truncate)
+	}
+}
+
 func isValidTruncate(truncate time.Duration) (valid bool) {
 	switch truncate {
-	case time.Hour:
-	case time.Minute:
-	case time.Second:
+	case Year:
+	case Month:
+	case Week:
+	case Day:
+	case Hour:
+	case Minute:
+	case Second:
 	default:
 		return false
 	}
@@ -93,6 +84,50 @@ func isValidTruncate(truncate time.Duration) (valid bool) {
 	return true
 }
 
+// newCountWriter will return a new writer which counts the bytes written to the provided writer
+func newCountWriter(w io.Writer) *countWriter {
+	var c countWriter
+	c.w = w
+	return &c
+}
+
+// countWriter tracks the number of bytes written to it's underlying writer
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write will write to the underlying writer and increment the byte count
+func (c *countWriter) Write(bs []byte) (n int, err error) {
+	n, err = c.w.Write(bs)
+	c.n += int64(n)
+	return
+}
+
+// newContextWriter will return a new writer which fails once the provided context is done
+func newContextWriter(ctx context.Context, w io.Writer) *contextWriter {
+	var c contextWriter
+	c.ctx = ctx
+	c.w = w
+	return &c
+}
+
+// contextWriter is a writer which fails once it's context is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write will write to the underlying writer as long as the context is not done
+func (c *contextWriter) Write(bs []byte) (n int, err error) {
+	// Ensure our context hasn't been cancelled
+	if err = c.ctx.Err(); err != nil {
+		return
+	}
+
+	return c.w.Write(bs)
+}
+
 // Frontend is the interface for values which can be used for snapshots
 type Frontend interface {
 	Copy(w io.Writer) error
@@ -106,3 +141,39 @@ type Backend interface {
 	List(prefix, marker string, maxKeys int64) ([]string, error)
 	Next(prefix, marker string) (string, error)
 }
+
+// newSemaphore will return a new semaphore which allows the provided number of concurrent holders
+// Note: A limit less than one returns a nil semaphore, which does not limit
+func newSemaphore(limit int) semaphore {
+	if limit < 1 {
+		return nil
+	}
+
+	return make(semaphore, limit)
+}
+
+// semaphore limits the number of concurrent holders
+type semaphore chan struct{}
+
+// acquire will wait until the semaphore can be held or the context is done
+func (s semaphore) acquire(ctx context.Context) (err error) {
+	if s == nil {
+		return
+	}
+
+	select {
+	case s <- struct{}{}:
+		return
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release will release a hold on the semaphore
+func (s semaphore) release() {
+	if s == nil {
+		return
+	}
+
+	<-s
+}
@@ -0,0 +1,54 @@
+package snapshotter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTruncated(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	// Friday, March 1st 2024 at 14:35:21.5 (a leap year, so the previous day is February 29th)
+	ts := time.Date(2024, time.March, 1, 14, 35, 21, 500, loc)
+	tcs := []struct {
+		truncate time.Duration
+		expected time.Time
+	}{
+		{truncate: Second, expected: time.Date(2024, time.March, 1, 14, 35, 21, 0, loc)},
+		{truncate: Minute, expected: time.Date(2024, time.March, 1, 14, 35, 0, 0, loc)},
+		{truncate: Hour, expected: time.Date(2024, time.March, 1, 14, 0, 0, 0, loc)},
+		{truncate: Day, expected: time.Date(2024, time.March, 1, 0, 0, 0, 0, loc)},
+		{truncate: Week, expected: time.Date(2024, time.February, 26, 0, 0, 0, 0, loc)},
+		{truncate: Month, expected: time.Date(2024, time.March, 1, 0, 0, 0, 0, loc)},
+		{truncate: Year, expected: time.Date(2024, time.January, 1, 0, 0, 0, 0, loc)},
+	}
+
+	for _, tc := range tcs {
+		if !isValidTruncate(tc.truncate) {
+			t.Fatalf("expected %v to be a valid truncate", tc.truncate)
+		}
+
+		if truncated := getTruncated(ts, tc.truncate); !truncated.Equal(tc.expected) {
+			t.Fatalf("invalid truncated time for %v, expected %v and received %v", tc.truncate, tc.expected, truncated)
+		}
+	}
+
+	// Sundays belong to the week which began the previous Monday
+	sunday := time.Date(2024, time.March, 3, 23, 0, 0, 0, time.UTC)
+	if truncated := getTruncated(sunday, Week); !truncated.Equal(time.Date(2024, time.February, 26, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("invalid truncated time for Sunday, received %v", truncated)
+	}
+
+	// The same instant truncates to different days depending on the location
+	instant := time.Date(2024, time.March, 2, 3, 0, 0, 0, time.UTC)
+	if utc, local := getTruncated(instant, Day), getTruncated(instant.In(loc), Day); utc.Equal(local) {
+		t.Fatalf("expected UTC and local days to differ, received %v for both", utc)
+	}
+
+	if isValidTruncate(time.Hour * 2) {
+		t.Fatal("expected two hours to be an invalid truncate")
+	}
+}
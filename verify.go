@@ -0,0 +1,220 @@
+package snapshotter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/hatchify/errors"
+)
+
+// ErrChecksumMismatch is returned when a snapshot does not match the checksum recorded within it's manifest
+type ErrChecksumMismatch struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+// Error will return the error message
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("checksum mismatch for \"%s\", expected %s and received %s", e.Key, e.Expected, e.Actual)
+}
+
+// ScrubReport is the outcome of a scrub
+type ScrubReport struct {
+	// Verified are the snapshots which matched their recorded checksum
+	Verified []string
+	// Unverified are the snapshots which do not have a manifest to verify against
+	Unverified []string
+	// Corrupted are the snapshots which did not match their recorded checksum
+	Corrupted []ScrubFailure
+	// Failed are the snapshots which could not be read
+	Failed []ScrubFailure
+}
+
+// ScrubFailure is a snapshot which could not be verified
+type ScrubFailure struct {
+	Key string
+	Err error
+}
+
+// Scrub will re-read every stored snapshot and verify it against the checksum within it's manifest
+func (s *Snapshotter) Scrub() (report ScrubReport, err error) {
+	// Ensure our service hasn't been closed
+	if s.closed.Get() {
+		// Service has been closed, return
+		err = errors.ErrIsClosed
+		return
+	}
+
+	return s.scrub(s.work)
+}
+
+// scrubLoop will continuously scrub on a provided interval until the lifecycle context is done
+func (s *Snapshotter) scrubLoop(interval time.Duration) {
+	// Notify the wait group once the loop has exited
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			// Service is closing, return
+			return
+		case <-ticker.C:
+		}
+
+		report, err := s.scrub(s.work)
+		if err != nil {
+			s.cfg.Logger.Error("error encountered scrubbing", Fields{"name": s.cfg.Name, "error": err})
+		}
+
+		for _, failure := range report.Corrupted {
+			s.cfg.Logger.Error("corrupted snapshot found while scrubbing", Fields{"name": s.cfg.Name, "key": failure.Key, "error": failure.Err})
+		}
+
+		for _, failure := range report.Failed {
+			s.cfg.Logger.Error("error reading snapshot while scrubbing", Fields{"name": s.cfg.Name, "key": failure.Key, "error": failure.Err})
+		}
+	}
+}
+
+func (s *Snapshotter) scrub(ctx context.Context) (report ScrubReport, err error) {
+	var entries []snapshotEntry
+	if entries, _, err = s.listEntries(ctx); err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		m, merr := s.lookupManifest(ctx, entry.key)
+		if merr != nil && merr != errNoManifest {
+			// Manifest could not be read, the snapshot cannot be verified
+			report.Failed = append(report.Failed, ScrubFailure{Key: entry.key, Err: merr})
+			continue
+		}
+
+		if len(m.SHA256) == 0 {
+			// Snapshots made by older versions will not have a manifest
+			report.Unverified = append(report.Unverified, entry.key)
+			continue
+		}
+
+		verr := readFrom(ctx, s.be, entry.key, func(r io.Reader) error {
+			return verifyChecksum(entry.key, m.SHA256, r, func(r io.Reader) (err error) {
+				_, err = io.Copy(ioutil.Discard, r)
+				return
+			})
+		})
+
+		switch verr.(type) {
+		case nil:
+			report.Verified = append(report.Verified, entry.key)
+		case *ErrChecksumMismatch:
+			report.Corrupted = append(report.Corrupted, ScrubFailure{Key: entry.key, Err: verr})
+			s.hooks.emitCorruption(entry.key, verr)
+		default:
+			report.Failed = append(report.Failed, ScrubFailure{Key: entry.key, Err: verr})
+		}
+	}
+
+	return
+}
+
+// load will pass a reader for the provided key to the provided function, verifying the
+// snapshot against the checksum within it's manifest (when available)
+func (s *Snapshotter) load(ctx context.Context, key string, fn func(io.Reader) error) (err error) {
+	var m Manifest
+	if m, err = s.lookupManifest(ctx, key); err == errNoManifest {
+		// Snapshots made by older versions will not have a manifest, these are passed through unverified
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	// Expected checksum and front-end compression of the snapshot
+	checksum := m.SHA256
+	compression := m.Compression
+
+	if len(s.cfg.TrustedKeys) > 0 {
+		// Trusted keys are configured, the snapshot must carry a valid signature
+		var sig Signature
+		if sig, err = getSignature(ctx, s.be, key); err != nil {
+			return
+		}
+
+		if err = sig.verify(key, s.cfg.TrustedKeys); err != nil {
+			return
+		}
+
+		// Use the signed checksum and compression rather than the (unsigned) manifest
+		checksum = sig.SHA256
+		compression = sig.Compression
+	}
+
+	if len(compression) > 0 {
+		// Snapshot was compressed by the front-end, decompress before passing to the provided function
+		// Note: Snapshots compressed by a back-end decorator have already been decompressed
+		// by the time they reach us
+		fn = decompressFn(Codec(compression), fn)
+	}
+
+	return readFrom(ctx, s.be, key, func(r io.Reader) error {
+		if len(checksum) == 0 {
+			return fn(r)
+		}
+
+		return verifyChecksum(key, checksum, r, fn)
+	})
+}
+
+// verifyChecksum will verify the reader against the expected checksum. Seekable readers are
+// verified before being passed to the provided function. Otherwise, the reader is verified
+// as it is consumed and a mismatch is returned after the function has completed
+func verifyChecksum(key, expected string, r io.Reader, fn func(io.Reader) error) (err error) {
+	hash := sha256.New()
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if _, serr := rs.Seek(0, io.SeekCurrent); serr == nil {
+			// Reader is seekable, verify before passing to the provided function
+			if _, err = io.Copy(hash, rs); err != nil {
+				return
+			}
+
+			if err = compareChecksum(key, expected, hash.Sum(nil)); err != nil {
+				return
+			}
+
+			if _, err = rs.Seek(0, io.SeekStart); err != nil {
+				return
+			}
+
+			return fn(rs)
+		}
+	}
+
+	tee := io.TeeReader(r, hash)
+	if err = fn(tee); err != nil {
+		return
+	}
+
+	// Ensure the entire snapshot has been hashed
+	if _, err = io.Copy(ioutil.Discard, tee); err != nil {
+		return
+	}
+
+	return compareChecksum(key, expected, hash.Sum(nil))
+}
+
+func compareChecksum(key, expected string, sum []byte) (err error) {
+	actual := hex.EncodeToString(sum)
+	if actual == expected {
+		return
+	}
+
+	return &ErrChecksumMismatch{Key: key, Expected: expected, Actual: actual}
+}
@@ -0,0 +1,155 @@
+package snapshotter
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/gdbu/snapshotter/backends"
+	"github.com/hatchify/atoms"
+)
+
+func TestSnapshotter_LoadChecksum(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend
+	be := backends.NewFile(backendTestDir)
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	discard := func(r io.Reader) (err error) {
+		_, err = io.Copy(ioutil.Discard, r)
+		return
+	}
+
+	if err = s.Load(latest, discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate bit rot by modifying the stored snapshot
+	if err = ioutil.WriteFile(path.Join(backendTestDir, latest), []byte("hello w0rld"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Load(latest, discard); err == nil {
+		t.Fatal("expected checksum mismatch and received nil")
+	} else if _, ok := err.(*ErrChecksumMismatch); !ok {
+		t.Fatalf("invalid error, expected checksum mismatch and received %v", err)
+	}
+
+	var report ScrubReport
+	if report, err = s.Scrub(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Corrupted) != 1 || report.Corrupted[0].Key != latest {
+		t.Fatalf("invalid corrupted keys, expected [%s] and received %+v", latest, report.Corrupted)
+	}
+}
+
+func TestSnapshotter_LoadManifestError(t *testing.T) {
+	var (
+		s   *Snapshotter
+		err error
+	)
+
+	// Defer the removal of our backend test directory
+	defer os.RemoveAll(backendTestDir)
+	// Initialize a new file backend which can fail reads of manifests
+	be := &testFailingReadBackend{Backend: backends.NewFile(backendTestDir), suffix: manifestSuffix}
+
+	// Initialize configuration
+	cfg := NewConfig("test", "txt")
+	// Set interval to an hour so only our manual snapshot will run
+	cfg.Interval = Hour
+
+	if s, err = New(&testFrontend{}, be, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest string
+	if latest, err = s.LatestKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write a key made by an older version, which does not have a manifest
+	legacyKey := "test.1792245600.txt"
+	if err = be.WriteTo(legacyKey, func(w io.Writer) (err error) {
+		_, err = w.Write([]byte("hello world"))
+		return
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	be.enabled.Set(true)
+
+	// A manifest which cannot be read must not be treated as a snapshot without a manifest
+	if err = s.Load(latest, confirmHelloWorld); err != errTestTransient {
+		t.Fatalf("invalid error, expected %v and received %v", errTestTransient, err)
+	}
+
+	// Snapshots without a manifest are passed through unverified
+	if err = s.Load(legacyKey, confirmHelloWorld); err != nil {
+		t.Fatal(err)
+	}
+
+	var report ScrubReport
+	if report, err = s.Scrub(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Failed) != 1 || report.Failed[0].Key != latest || report.Failed[0].Err != errTestTransient {
+		t.Fatalf("invalid failed keys, expected [%s] and received %+v", latest, report.Failed)
+	}
+
+	if len(report.Unverified) != 1 || report.Unverified[0] != legacyKey {
+		t.Fatalf("invalid unverified keys, expected [%s] and received %v", legacyKey, report.Unverified)
+	}
+}
+
+// testFailingReadBackend is a back-end which fails reads of keys ending with a suffix while enabled
+type testFailingReadBackend struct {
+	Backend
+
+	suffix  string
+	enabled atoms.Bool
+}
+
+// ReadFrom will pass a reader to the provided function
+func (f *testFailingReadBackend) ReadFrom(key string, fn func(io.Reader) error) (err error) {
+	if f.enabled.Get() && strings.HasSuffix(key, f.suffix) {
+		return errTestTransient
+	}
+
+	return f.Backend.ReadFrom(key, fn)
+}
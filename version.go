@@ -0,0 +1,61 @@
+package snapshotter
+
+import "runtime/debug"
+
+const (
+	// modulePath is the module path of snapshotter, used to find it's version within the build info
+	modulePath = "github.com/gdbu/snapshotter"
+	// develVersion is the version reported when snapshotter was not built as a versioned module
+	develVersion = "(devel)"
+)
+
+// Version is the version of snapshotter, this is recorded within each manifest
+// Note: Version may be set at build time using -ldflags "-X github.com/gdbu/snapshotter.Version=v1.2.3",
+// otherwise it is read from the build info of the binary
+var Version string
+
+func init() {
+	if len(Version) > 0 {
+		// Version was set at build time, return
+		return
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		// Binary was not built with module support
+		Version = develVersion
+		return
+	}
+
+	Version = versionFromBuildInfo(info)
+}
+
+// versionFromBuildInfo will return the version of snapshotter within the provided build info
+func versionFromBuildInfo(info *debug.BuildInfo) (version string) {
+	mod := &info.Main
+	if mod.Path != modulePath {
+		// Snapshotter is a dependency of the main module, find it's version
+		mod = nil
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				mod = dep
+				break
+			}
+		}
+	}
+
+	if mod == nil {
+		return develVersion
+	}
+
+	if mod.Replace != nil && len(mod.Replace.Version) > 0 {
+		// Module was replaced by another version
+		mod = mod.Replace
+	}
+
+	if len(mod.Version) == 0 {
+		return develVersion
+	}
+
+	return mod.Version
+}
@@ -0,0 +1,52 @@
+package snapshotter
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestVersionFromBuildInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     debug.BuildInfo
+		expected string
+	}{
+		{
+			name:     "main module",
+			info:     debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "v0.6.0"}},
+			expected: "v0.6.0",
+		},
+		{
+			name:     "main module without a version",
+			info:     debug.BuildInfo{Main: debug.Module{Path: modulePath}},
+			expected: develVersion,
+		},
+		{
+			name: "dependency",
+			info: debug.BuildInfo{
+				Main: debug.Module{Path: "example.com/service", Version: "v1.0.0"},
+				Deps: []*debug.Module{{Path: "example.com/other", Version: "v2.0.0"}, {Path: modulePath, Version: "v0.6.1"}},
+			},
+			expected: "v0.6.1",
+		},
+		{
+			name: "replaced dependency",
+			info: debug.BuildInfo{
+				Main: debug.Module{Path: "example.com/service"},
+				Deps: []*debug.Module{{Path: modulePath, Version: "v0.6.1", Replace: &debug.Module{Path: "example.com/fork", Version: "v0.6.2"}}},
+			},
+			expected: "v0.6.2",
+		},
+		{
+			name:     "not a dependency",
+			info:     debug.BuildInfo{Main: debug.Module{Path: "example.com/service", Version: "v1.0.0"}},
+			expected: develVersion,
+		},
+	}
+
+	for _, test := range tests {
+		if version := versionFromBuildInfo(&test.info); version != test.expected {
+			t.Fatalf("%s: invalid version, expected \"%s\" and received \"%s\"", test.name, test.expected, version)
+		}
+	}
+}